@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+// authenticateRequest validates the access token in the Authorization header
+// and checks that the session it belongs to is still active and that the
+// user is not suspended or banned. Personal access tokens are refused, so use
+// it for account management. When it returns false the error response has
+// already been written.
+func (cfg *apiConfig) authenticateRequest(writer http.ResponseWriter, req *http.Request) (auth.Claims, bool) {
+	return cfg.authenticate(writer, req, "")
+}
+
+// authenticateWithScope is like authenticateRequest but also accepts personal
+// access tokens that were granted scope.
+func (cfg *apiConfig) authenticateWithScope(writer http.ResponseWriter, req *http.Request, scope string) (auth.Claims, bool) {
+	return cfg.authenticate(writer, req, scope)
+}
+
+func (cfg *apiConfig) authenticate(writer http.ResponseWriter, req *http.Request, scope string) (auth.Claims, bool) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(writer, 401, "Unable to Get Client Token", err)
+		return auth.Claims{}, false
+	}
+
+	var claims auth.Claims
+	var ok bool
+	if auth.IsPersonalAccessToken(token) {
+		claims, ok = cfg.authenticatePersonalAccessToken(writer, req, token, scope)
+	} else {
+		claims, ok = cfg.authenticateSession(writer, req, token)
+	}
+	if !ok {
+		return auth.Claims{}, false
+	}
+
+	//Checked on every request so suspensions apply to tokens already issued
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 401, "Unauthorized Request", err)
+		return auth.Claims{}, false
+	}
+	if rejectRestrictedUser(writer, user) {
+		return auth.Claims{}, false
+	}
+
+	return claims, true
+}
+
+func (cfg *apiConfig) authenticateSession(writer http.ResponseWriter, req *http.Request, token string) (auth.Claims, bool) {
+
+	claims, err := auth.ValidateJWT(token, cfg.jwt_keys)
+	if err != nil {
+		respondWithError(writer, 401, "Unauthorized Request", err)
+		return auth.Claims{}, false
+	}
+
+	active, err := cfg.db.IsSessionActive(req.Context(), database.IsSessionActiveParams{FamilyID: claims.SessionID, UserID: claims.UserID})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Check Session", err)
+		return auth.Claims{}, false
+	}
+	if !active {
+		respondWithError(writer, 401, "Session Has Been Revoked", nil)
+		return auth.Claims{}, false
+	}
+
+	return claims, true
+}
+
+func (cfg *apiConfig) authenticatePersonalAccessToken(writer http.ResponseWriter, req *http.Request, token, scope string) (auth.Claims, bool) {
+	pat, err := cfg.db.GetActivePersonalAccessToken(req.Context(), auth.HashToken(token))
+	if err != nil {
+		respondWithError(writer, 401, "Unauthorized Request", err)
+		return auth.Claims{}, false
+	}
+
+	if scope == "" {
+		respondWithError(writer, 403, "Personal Access Tokens Are Not Allowed Here", nil)
+		return auth.Claims{}, false
+	}
+
+	claims := auth.PersonalAccessTokenClaims(pat.UserID, pat.ID, pat.Scopes)
+	if !claims.HasScope(scope) {
+		respondWithError(writer, 403, "Token is Missing Required Scope", nil)
+		return auth.Claims{}, false
+	}
+
+	err = cfg.db.TouchPersonalAccessToken(req.Context(), pat.ID)
+	if err != nil {
+		log.Printf("Error recording token use: %s", err)
+	}
+
+	return claims, true
+}
+
+// viewerID identifies the caller of a public endpoint so responses can be
+// personalised. It applies the same session, token and suspension checks as
+// authenticate, but anonymous callers and anything that fails them get
+// uuid.Nil rather than an error.
+func (cfg *apiConfig) viewerID(req *http.Request) uuid.UUID {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return uuid.Nil
+	}
+
+	var user_id uuid.UUID
+	if auth.IsPersonalAccessToken(token) {
+		pat, err := cfg.db.GetActivePersonalAccessToken(req.Context(), auth.HashToken(token))
+		if err != nil {
+			return uuid.Nil
+		}
+		user_id = pat.UserID
+	} else {
+		claims, err := auth.ValidateJWT(token, cfg.jwt_keys)
+		if err != nil {
+			return uuid.Nil
+		}
+		active, err := cfg.db.IsSessionActive(req.Context(), database.IsSessionActiveParams{FamilyID: claims.SessionID, UserID: claims.UserID})
+		if err != nil || !active {
+			return uuid.Nil
+		}
+		user_id = claims.UserID
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), user_id)
+	if err != nil || isRestrictedUser(user) {
+		return uuid.Nil
+	}
+	return user.ID
+}
@@ -3,9 +3,12 @@ module github.com/jja42/chirpy
 go 1.24.4
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.3
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.40.0
-	github.com/golang-jwt/jwt/v5 v5.2.3
+	golang.org/x/image v0.25.0
 )
+
+require golang.org/x/sys v0.34.0 // indirect
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"sort"
+	"net/url"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/jja42/chirpy/internal/auth"
@@ -26,12 +30,56 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+// middlewareCacheForever marks successful responses as immutable. Only use it
+// for files whose names change whenever their contents do. Errors are left
+// alone so a missing file can show up later without clients caching the 404.
+func middlewareCacheForever(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(&cacheForeverWriter{ResponseWriter: writer}, req)
+	})
+}
+
+type cacheForeverWriter struct {
+	http.ResponseWriter
+	wrote_header bool
+}
+
+func (writer *cacheForeverWriter) WriteHeader(code int) {
+	if !writer.wrote_header {
+		writer.wrote_header = true
+		if code == 200 || code == 304 {
+			writer.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+	}
+	writer.ResponseWriter.WriteHeader(code)
+}
+
+func (writer *cacheForeverWriter) Write(data []byte) (int, error) {
+	if !writer.wrote_header {
+		writer.WriteHeader(200)
+	}
+	return writer.ResponseWriter.Write(data)
+}
+
+func (writer *cacheForeverWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
 func (cfg *apiConfig) handlerMetrics(writer http.ResponseWriter, req *http.Request) {
 	str := fmt.Sprintf("<html>\n<body>\n<h1>Welcome, Chirpy Admin</h1>\n<p>Chirpy has been visited %d times!</p>\n</body>\n</html>", cfg.fileserverHits.Load())
 	writer.Header().Set("Content-Type", "text/html")
 	writer.Write([]byte(str))
 }
 
+func (cfg *apiConfig) handlerJWKS(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(writer, 200, cfg.jwt_keys.JWKS())
+}
+
+// handlerReset wipes every user. It exists for test runs, so on top of the
+// admin role it stays limited to development deployments: one stolen or
+// mistaken admin session must never be able to erase production data, and
+// nothing outside of development has a reason to call it.
 func (cfg *apiConfig) handlerReset(writer http.ResponseWriter, req *http.Request) {
 	if cfg.platform != "dev" {
 		respondWithError(writer, 403, "Access Forbidden", nil)
@@ -51,6 +99,7 @@ func (cfg *apiConfig) handlerCreateUser(writer http.ResponseWriter, req *http.Re
 	type Parameters struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
+		Handle   string `json:"handle"`
 	}
 
 	decoder := json.NewDecoder(req.Body)
@@ -63,6 +112,16 @@ func (cfg *apiConfig) handlerCreateUser(writer http.ResponseWriter, req *http.Re
 		return
 	}
 
+	//A handle is optional at sign-up and can be picked later
+	handle := normalizeHandle(params.Handle)
+	if handle != "" {
+		err = validateHandle(handle)
+		if err != nil {
+			respondWithError(writer, 400, "Invalid Handle", err)
+			return
+		}
+	}
+
 	hashed_password, err := auth.HashPassword(params.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %s", err)
@@ -70,68 +129,213 @@ func (cfg *apiConfig) handlerCreateUser(writer http.ResponseWriter, req *http.Re
 		return
 	}
 
-	user_params := database.CreateUserParams{Email: params.Email, HashedPassword: hashed_password}
+	user_params := database.CreateUserParams{Email: params.Email, HashedPassword: hashed_password,
+		Handle: sql.NullString{String: handle, Valid: handle != ""}}
 
 	user, err := cfg.db.CreateUser(req.Context(), user_params)
+	if isUniqueViolation(err) {
+		respondWithError(writer, 409, "Email or Handle Already in Use", err)
+		return
+	}
 	if err != nil {
 		respondWithError(writer, 500, "Unable to Create User", err)
 		return
 	}
 
-	user_response := UserResponse{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, ChirpyRed: user.IsChirpyRed}
+	//Account stays usable for reading even if the email fails to send
+	err = cfg.sendVerificationEmail(req.Context(), user)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
+	user_response := newUserResponse(user)
 
 	respondWithJSON(writer, 201, user_response)
 }
 
-func (cfg *apiConfig) handlerUpdateUser(writer http.ResponseWriter, req *http.Request) {
-	//Get Access Token
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(writer, 401, "Unable to Get Client Token", err)
+// handlerPatchUser only changes the fields present in the request. Changing
+// the email or password needs the current password as well as a session;
+// profile fields only need a session or a token with profile:write.
+func (cfg *apiConfig) handlerPatchUser(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeProfileWrite)
+	if !ok {
 		return
 	}
 
-	user_id, err := auth.ValidateJWT(token, cfg.jwt_secret)
-	if err != nil {
-		respondWithError(writer, 401, "Unauthorized Request", err)
-		return
-	}
-
-	//New Params
 	type Parameters struct {
-		NewPassword string `json:"password"`
-		NewEmail    string `json:"email"`
+		CurrentPassword string  `json:"current_password"`
+		NewPassword     *string `json:"password"`
+		NewEmail        *string `json:"email"`
+		Handle          *string `json:"handle"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		AvatarURL       *string `json:"avatar_url"`
 	}
 
 	decoder := json.NewDecoder(req.Body)
 	params := Parameters{}
 
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		log.Printf("Error decoding parameters: %s", err)
 		respondWithError(writer, 500, "Unable to Decode JSON", err)
 		return
 	}
 
-	hashed_password, err := auth.HashPassword(params.NewPassword)
+	if params.NewEmail == nil && params.NewPassword == nil && params.Handle == nil && params.DisplayName == nil && params.Bio == nil && params.AvatarURL == nil {
+		respondWithError(writer, 400, "No Fields to Update", nil)
+		return
+	}
+
+	if params.NewEmail != nil && *params.NewEmail == "" {
+		respondWithError(writer, 400, "Email Cannot Be Empty", nil)
+		return
+	}
+
+	if params.NewPassword != nil && *params.NewPassword == "" {
+		respondWithError(writer, 400, "Password Cannot Be Empty", nil)
+		return
+	}
+
+	//Tokens can edit the profile but never take over the account
+	if (params.NewEmail != nil || params.NewPassword != nil) && claims.IsPersonalAccessToken() {
+		respondWithError(writer, 403, "Personal Access Tokens Cannot Change Email or Password", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		respondWithError(writer, 500, "Unable to Update User", err)
+		respondWithError(writer, 404, "User Not Found", err)
 		return
 	}
 
-	//Update User
-	user, err := cfg.db.UpdateUser(req.Context(), database.UpdateUserParams{ID: user_id, Email: params.NewEmail, HashedPassword: hashed_password})
+	if params.NewEmail != nil || params.NewPassword != nil {
+		_, err = auth.CheckPasswordHash(params.CurrentPassword, user.HashedPassword)
+		if err != nil {
+			respondWithError(writer, 401, "Current Password is Incorrect", err)
+			return
+		}
+	}
+
+	patch := database.PatchUserParams{ID: user.ID}
+
+	if params.Handle != nil {
+		handle := normalizeHandle(*params.Handle)
+		err = validateHandle(handle)
+		if err != nil {
+			respondWithError(writer, 400, "Invalid Handle", err)
+			return
+		}
+		patch.Handle = sql.NullString{String: handle, Valid: true}
+	}
+
+	if params.DisplayName != nil {
+		if utf8.RuneCountInString(*params.DisplayName) > 50 {
+			respondWithError(writer, 400, "Display Name is Too Long", nil)
+			return
+		}
+		patch.DisplayName = sql.NullString{String: *params.DisplayName, Valid: true}
+	}
+
+	if params.Bio != nil {
+		if utf8.RuneCountInString(*params.Bio) > 160 {
+			respondWithError(writer, 400, "Bio is Too Long", nil)
+			return
+		}
+		patch.Bio = sql.NullString{String: *params.Bio, Valid: true}
+	}
+
+	if params.AvatarURL != nil {
+		avatar_url, err := url.Parse(*params.AvatarURL)
+		if *params.AvatarURL != "" && (err != nil || (avatar_url.Scheme != "https" && avatar_url.Scheme != "http") || avatar_url.Host == "") {
+			respondWithError(writer, 400, "Invalid Avatar URL", err)
+			return
+		}
+		patch.AvatarUrl = sql.NullString{String: *params.AvatarURL, Valid: true}
+	}
+
+	if params.NewEmail != nil {
+		patch.Email = sql.NullString{String: *params.NewEmail, Valid: true}
+	}
+
+	if params.NewPassword != nil {
+		hashed_password, err := auth.HashPassword(*params.NewPassword)
+		if err != nil {
+			log.Printf("Error hashing password: %s", err)
+			respondWithError(writer, 500, "Unable to Update User", err)
+			return
+		}
+		patch.HashedPassword = sql.NullString{String: hashed_password, Valid: true}
+	}
+
+	updated, err := cfg.db.PatchUser(req.Context(), patch)
+	if isUniqueViolation(err) {
+		respondWithError(writer, 409, "Email or Handle Already in Use", err)
+		return
+	}
 	if err != nil {
-		respondWithError(writer, 401, "Incorrect email or password", err)
+		respondWithError(writer, 500, "Unable to Update User", err)
 		return
 	}
 
-	user_response := UserResponse{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, ChirpyRed: user.IsChirpyRed}
+	//Anyone else holding a session or token may know the old password
+	if params.NewPassword != nil {
+		err = cfg.db.RevokeOtherUserSessions(req.Context(), database.RevokeOtherUserSessionsParams{UserID: user.ID, FamilyID: claims.SessionID})
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Revoke Sessions", err)
+			return
+		}
+
+		err = cfg.db.RevokeUserPersonalAccessTokens(req.Context(), user.ID)
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Revoke Tokens", err)
+			return
+		}
+	}
+
+	//A new address has to be verified again
+	if updated.Email != user.Email {
+		err = cfg.db.ExpireUserVerificationTokens(req.Context(), user.ID)
+		if err == nil {
+			err = cfg.sendVerificationEmail(req.Context(), updated)
+		}
+		if err != nil {
+			log.Printf("Error sending verification email: %s", err)
+		}
+	}
+
+	user_response := newUserResponse(updated)
 
 	respondWithJSON(writer, 200, user_response)
 }
 
+func (cfg *apiConfig) handlerGetCurrentUser(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeProfileRead)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, newUserResponse(user))
+}
+
+func (cfg *apiConfig) handlerGetProfile(writer http.ResponseWriter, req *http.Request) {
+	handle := normalizeHandle(req.PathValue("handle"))
+
+	user, err := cfg.db.GetUserByHandle(req.Context(), handle)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, newProfileResponse(user))
+}
+
 func (cfg *apiConfig) handlerLogin(writer http.ResponseWriter, req *http.Request) {
 	type Parameters struct {
 		Password string `json:"password"`
@@ -148,19 +352,75 @@ func (cfg *apiConfig) handlerLogin(writer http.ResponseWriter, req *http.Request
 		return
 	}
 
+	account_key := loginAccountKey(params.Email)
+	ip_key := loginIPKey(clientIP(req))
+
+	if cfg.rejectLockedLogin(writer, req, account_key, ip_key) {
+		return
+	}
+
 	user, err := cfg.db.GetUser(req.Context(), params.Email)
 	if err != nil {
+		cfg.recordLoginFailure(req, account_key, ip_key)
 		respondWithError(writer, 401, "Incorrect email or password", err)
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	needs_rehash, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
 	if err != nil {
+		cfg.recordLoginFailure(req, account_key, ip_key)
 		respondWithError(writer, 401, "Incorrect email or password", err)
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.jwt_secret, time.Hour)
+	//Upgrade old hashes while we have the plaintext password
+	if needs_rehash {
+		cfg.rehashPassword(req.Context(), user.ID, params.Password)
+	}
+
+	if rejectRestrictedUser(writer, user) {
+		return
+	}
+
+	//Accounts with 2FA have to finish logging in at /api/login/mfa, and their
+	//failures are only cleared once the second factor checks out there
+	if user.TotpEnabled {
+		cfg.startMFAChallenge(writer, req, user)
+		return
+	}
+
+	err = cfg.login_account_limiter.Reset(req.Context(), account_key)
+	if err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
+
+	cfg.startSession(writer, req, user)
+}
+
+func (cfg *apiConfig) rehashPassword(ctx context.Context, user_id uuid.UUID, password string) {
+	hashed_password, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+
+	err = cfg.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: user_id, HashedPassword: hashed_password})
+	if err != nil {
+		log.Printf("Error saving rehashed password: %s", err)
+	}
+}
+
+// accessTokenTTL is how long access tokens last. Retired signing keys are kept
+// for at least as long.
+const accessTokenTTL = time.Hour
+
+// startSession logs user in: it opens a new session and responds with an
+// access token and the first refresh token of the session.
+func (cfg *apiConfig) startSession(writer http.ResponseWriter, req *http.Request, user database.User) {
+	//Each login starts a new token family, which is also the session ID
+	session_id := uuid.New()
+
+	token, err := auth.MakeJWT(user.ID, session_id, user.Role, cfg.jwt_keys, accessTokenTTL)
 	if err != nil {
 		respondWithError(writer, 401, "Unable to Make JWT", err)
 		return
@@ -168,33 +428,156 @@ func (cfg *apiConfig) handlerLogin(writer http.ResponseWriter, req *http.Request
 
 	refresh_token := auth.MakeRefreshToken()
 
-	cfg.db.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
-		Token: refresh_token, UserID: user.ID, ExpiresAt: time.Now().AddDate(0, 0, 60),
+	err = cfg.db.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refresh_token), UserID: user.ID, ExpiresAt: time.Now().AddDate(0, 0, 60), FamilyID: session_id,
+		UserAgent: req.UserAgent(), IpAddress: clientIP(req),
 	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Create Refresh Token", err)
+		return
+	}
 
-	user_response := UserResponse{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt,
-		Email: user.Email, Token: token, RefreshToken: refresh_token, ChirpyRed: user.IsChirpyRed}
+	user_response := newUserResponse(user)
+	user_response.Token = token
+	user_response.RefreshToken = refresh_token
 
 	respondWithJSON(writer, 200, user_response)
 }
 
-func (cfg *apiConfig) handlerCreateChirp(writer http.ResponseWriter, req *http.Request) {
+// chirpResponses converts chirps for the API, looking up the handles of all
+// their authors, their counts and the chirps they rechirp in one query each.
+// viewer_id fills in liked_by_me; pass uuid.Nil for anonymous requests.
+func (cfg *apiConfig) chirpResponses(ctx context.Context, viewer_id uuid.UUID, chirps []database.Chirp) ([]ChirpResponse, error) {
+	return cfg.buildChirpResponses(ctx, viewer_id, chirps, true)
+}
 
-	token, err := auth.GetBearerToken(req.Header)
+// buildChirpResponses only embeds rechirped chirps one level deep; a quote of
+// a quote shows the inner quote without what it quotes.
+func (cfg *apiConfig) buildChirpResponses(ctx context.Context, viewer_id uuid.UUID, chirps []database.Chirp, embed bool) ([]ChirpResponse, error) {
+	author_ids := []uuid.UUID{}
+	chirp_ids := []uuid.UUID{}
+	original_ids := []uuid.UUID{}
+	for _, chirp := range chirps {
+		author_ids = append(author_ids, chirp.UserID.UUID)
+		chirp_ids = append(chirp_ids, chirp.ID)
+		if chirp.RechirpOf.Valid {
+			original_ids = append(original_ids, chirp.RechirpOf.UUID)
+		}
+	}
+
+	rows, err := cfg.db.GetUserHandles(ctx, author_ids)
+	if err != nil {
+		return nil, err
+	}
+
+	handles := map[uuid.UUID]string{}
+	for _, row := range rows {
+		handles[row.ID] = row.Handle.String
+	}
+
+	count_rows, err := cfg.db.GetReplyCounts(ctx, chirp_ids)
+	if err != nil {
+		return nil, err
+	}
+
+	reply_counts := map[uuid.UUID]int64{}
+	for _, row := range count_rows {
+		reply_counts[row.ParentID.UUID] = row.ReplyCount
+	}
+
+	rechirp_rows, err := cfg.db.GetRechirpCounts(ctx, chirp_ids)
 	if err != nil {
-		respondWithError(writer, 401, "Unable to Get Client Token", err)
+		return nil, err
+	}
+
+	rechirp_counts := map[uuid.UUID]database.GetRechirpCountsRow{}
+	for _, row := range rechirp_rows {
+		rechirp_counts[row.RechirpOf.UUID] = row
+	}
+
+	liked := map[uuid.UUID]bool{}
+	if viewer_id != uuid.Nil {
+		liked_ids, err := cfg.db.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{UserID: viewer_id, Ids: chirp_ids})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range liked_ids {
+			liked[id] = true
+		}
+	}
+
+	//Deleted originals are still embedded, but only as tombstones
+	originals := map[uuid.UUID]ChirpResponse{}
+	if embed && len(original_ids) > 0 {
+		original_chirps, err := cfg.db.GetChirpsByIDs(ctx, original_ids)
+		if err != nil {
+			return nil, err
+		}
+
+		original_responses, err := cfg.buildChirpResponses(ctx, viewer_id, original_chirps, false)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, original := range original_chirps {
+			if original.DeletedAt.Valid {
+				original_responses[i] = tombstone(original_responses[i])
+			}
+			originals[original.ID] = original_responses[i]
+		}
+	}
+
+	Chirps := []ChirpResponse{}
+	for _, chirp := range chirps {
+		response := ChirpResponse{
+			ID:           chirp.ID,
+			CreatedAt:    chirp.CreatedAt,
+			UpdatedAt:    chirp.UpdatedAt,
+			Body:         chirp.Body,
+			UserID:       chirp.UserID.UUID,
+			AuthorHandle: handles[chirp.UserID.UUID],
+			ReplyCount:   reply_counts[chirp.ID],
+			RechirpCount: rechirp_counts[chirp.ID].RechirpCount,
+			QuoteCount:   rechirp_counts[chirp.ID].QuoteCount,
+			LikeCount:    chirp.LikeCount,
+			LikedByMe:    liked[chirp.ID],
+		}
+		if chirp.ParentID.Valid {
+			response.InReplyTo = &chirp.ParentID.UUID
+		}
+		if original, ok := originals[chirp.RechirpOf.UUID]; ok && chirp.RechirpOf.Valid {
+			response.RechirpOf = &original
+			response.IsQuote = chirp.IsQuote
+		}
+		Chirps = append(Chirps, response)
+	}
+
+	return Chirps, nil
+}
+
+func (cfg *apiConfig) handlerCreateChirp(writer http.ResponseWriter, req *http.Request) {
+
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
+	user_id := claims.UserID
 
-	user_id, err := auth.ValidateJWT(token, cfg.jwt_secret)
+	user, err := cfg.db.GetUserByID(req.Context(), user_id)
 	if err != nil {
 		respondWithError(writer, 401, "Unauthorized Request", err)
 		return
 	}
 
+	if !user.EmailVerified {
+		respondWithError(writer, 403, "Email Not Verified", nil)
+		return
+	}
+
 	//Ported Validate Chirp Logic
 	type Request struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
 	}
 
 	decoder := json.NewDecoder(req.Body)
@@ -206,74 +589,133 @@ func (cfg *apiConfig) handlerCreateChirp(writer http.ResponseWriter, req *http.R
 		return
 	}
 
-	if len(r.Body) > 140 {
-		respondWithError(writer, 400, "Chirp is too long", err)
+	cleaned_body, ok := cleanChirpBody(writer, r.Body)
+	if !ok {
 		return
 	}
 
-	//Chirp is Valid and will be Cleaned
-
-	cleaned_body := replaceProfaneText(r.Body)
-
 	//Now we need to touch the database
 
 	params := database.CreateChirpParams{Body: cleaned_body, UserID: user_id}
 
+	//Replies can only be made to chirps that are still visible
+	if r.InReplyTo != nil {
+		parent, err := cfg.db.GetChirp(req.Context(), *r.InReplyTo)
+		if err != nil {
+			respondWithError(writer, 404, "Parent Chirp Not Found", err)
+			return
+		}
+		//A plain rechirp has nothing to reply to, so reply to the original
+		if parent.RechirpOf.Valid && !parent.IsQuote {
+			parent.ID = parent.RechirpOf.UUID
+		}
+		params.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
 	chirp, err := cfg.db.CreateChirp(req.Context(), params)
 	if err != nil {
 		respondWithError(writer, 500, "Unable to Create Chirp", err)
 		return
 	}
 
-	response := ChirpResponse{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID}
+	response := ChirpResponse{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID.UUID,
+		AuthorHandle: user.Handle.String}
+	if chirp.ParentID.Valid {
+		response.InReplyTo = &chirp.ParentID.UUID
+	}
 
 	respondWithJSON(writer, 201, response)
 }
 
+// cleanChirpBody checks the length of a new chirp body and censors it. When
+// it returns false the error response has already been written.
+func cleanChirpBody(writer http.ResponseWriter, body string) (string, bool) {
+	if len(body) > maxChirpLength {
+		respondWithError(writer, 400, "Chirp is too long", nil)
+		return "", false
+	}
+
+	return replaceProfaneText(body), true
+}
+
+// handlerGetChirps returns one page of chirps, oldest first unless sort=desc.
+// Pass next_cursor back as cursor to get the following page.
 func (cfg *apiConfig) handlerGetChirps(writer http.ResponseWriter, req *http.Request) {
-	var chirps []database.Chirp
-	var err error
+	query := req.URL.Query()
 
-	author_id := req.URL.Query().Get("author_id")
+	author_id := query.Get("author_id")
 
-	if author_id != "" {
-		user_id, err := uuid.Parse(author_id)
+	//Authors can also be picked by handle instead of UUID
+	author_handle := normalizeHandle(query.Get("author_handle"))
+	if author_handle != "" {
+		author, err := cfg.db.GetUserByHandle(req.Context(), author_handle)
 		if err != nil {
-			respondWithError(writer, 500, "Unable to Parse Author ID", err)
+			respondWithError(writer, 404, "Author Not Found", err)
 			return
 		}
-		chirps, err = cfg.db.GetAuthorChirps(req.Context(), user_id)
+		author_id = author.ID.String()
+	}
+
+	limit, ok := parsePageLimit(writer, query)
+	if !ok {
+		return
+	}
+
+	//One extra row tells us whether there is another page
+	params := database.ListChirpsAscParams{Limit: limit + 1}
+
+	if author_id != "" {
+		user_id, err := uuid.Parse(author_id)
 		if err != nil {
-			respondWithError(writer, 500, "Unable to Get Chirps", err)
+			respondWithError(writer, 400, "Unable to Parse Author ID", err)
 			return
 		}
-	} else {
-		chirps, err = cfg.db.GetChirps(req.Context())
+		params.AuthorID = uuid.NullUUID{UUID: user_id, Valid: true}
+	}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		created_at, id, err := decodeChirpCursor(cursor)
 		if err != nil {
-			respondWithError(writer, 500, "Unable to Get Chirps", err)
+			respondWithError(writer, 400, "Invalid Cursor", err)
 			return
 		}
+		params.AfterCreatedAt = sql.NullTime{Time: created_at, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: id, Valid: true}
 	}
 
-	sort_param := req.URL.Query().Get("sort")
+	sort_param := query.Get("sort")
+	if sort_param != "" && sort_param != "asc" && sort_param != "desc" {
+		respondWithError(writer, 400, "Sort Must be asc or desc", nil)
+		return
+	}
 
+	var chirps []database.Chirp
+	var err error
 	if sort_param == "desc" {
-		sort.Slice(chirps, func(i, j int) bool { return chirps[i].CreatedAt.After(chirps[j].CreatedAt) })
+		chirps, err = cfg.db.ListChirpsDesc(req.Context(), database.ListChirpsDescParams(params))
+	} else {
+		chirps, err = cfg.db.ListChirpsAsc(req.Context(), params)
+	}
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Chirps", err)
+		return
 	}
 
-	var Chirps []ChirpResponse
+	next_cursor := ""
+	if len(chirps) == int(params.Limit) {
+		chirps = chirps[:len(chirps)-1]
+		last := chirps[len(chirps)-1]
+		next_cursor = encodeChirpCursor(last.CreatedAt, last.ID)
+	}
 
-	for _, chirp := range chirps {
-		Chirps = append(Chirps, ChirpResponse{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		})
+	Chirps, err := cfg.chirpResponses(req.Context(), cfg.viewerID(req), chirps)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Chirps", err)
+		return
 	}
 
-	respondWithJSON(writer, 200, Chirps)
+	respondWithJSON(writer, 200, ChirpPageResponse{Chirps: Chirps, NextCursor: next_cursor})
 }
 
 func (cfg *apiConfig) handlerGetChirp(writer http.ResponseWriter, req *http.Request) {
@@ -290,9 +732,13 @@ func (cfg *apiConfig) handlerGetChirp(writer http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	response := ChirpResponse{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.CreatedAt, Body: chirp.Body, UserID: chirp.UserID}
+	response, err := cfg.chirpResponses(req.Context(), cfg.viewerID(req), []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Chirp", err)
+		return
+	}
 
-	respondWithJSON(writer, 200, response)
+	respondWithJSON(writer, 200, response[0])
 }
 
 func (cfg *apiConfig) handlerDeleteChirp(writer http.ResponseWriter, req *http.Request) {
@@ -309,24 +755,27 @@ func (cfg *apiConfig) handlerDeleteChirp(writer http.ResponseWriter, req *http.R
 		return
 	}
 
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(writer, 401, "Unable to Get Client Token", err)
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsDelete)
+	if !ok {
 		return
 	}
+	user_id := claims.UserID
 
-	user_id, err := auth.ValidateJWT(token, cfg.jwt_secret)
-	if err != nil {
-		respondWithError(writer, 401, "Unauthorized Request", err)
+	if chirp.UserID.UUID != user_id {
+		respondWithError(writer, 403, "Unauthorized Request", err)
 		return
 	}
 
-	if chirp.UserID != user_id {
-		respondWithError(writer, 403, "Unauthorized Request", err)
+	//Deleted chirps sit in the trash until purgeDeletedChirps removes them
+	deleted, err := cfg.db.SoftDeleteChirp(req.Context(), chirp.ID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Delete Chirp", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(writer, 404, "Chirp Not Found", nil)
 		return
 	}
-
-	cfg.db.DeleteChirp(req.Context(), chirp.ID)
 
 	respondWithJSON(writer, 204, nil)
 }
@@ -338,39 +787,103 @@ func (cfg *apiConfig) handlerRefresh(writer http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	refresh_token, err := cfg.db.GetRefreshToken(req.Context(), token)
+	new_refresh_token := auth.MakeRefreshToken()
+
+	//Retire the presented token and issue its replacement atomically
+	tx, err := cfg.db_conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Rotate Refresh Token", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	refresh_token, err := qtx.RotateRefreshToken(req.Context(), database.RotateRefreshTokenParams{
+		TokenHash: auth.HashToken(token), ReplacedBy: sql.NullString{String: auth.HashToken(new_refresh_token), Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		cfg.rejectRefreshToken(writer, req, token)
+		return
+	}
 	if err != nil {
-		respondWithError(writer, 401, "Unable to Get Refresh Token from Database", err)
+		respondWithError(writer, 500, "Unable to Rotate Refresh Token", err)
 		return
 	}
 
-	expired := refresh_token.ExpiresAt.Before(time.Now())
-	if expired {
-		respondWithError(writer, 401, "Refresh Token is Expired", err)
+	//Read the user fresh so role and suspension changes apply on refresh
+	user, err := qtx.GetUserByID(req.Context(), refresh_token.UserID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get User", err)
 		return
 	}
 
-	revoked := refresh_token.RevokedAt.Valid
-	if revoked {
-		respondWithError(writer, 401, "Refresh Token is Revoked", err)
+	//Leave the presented token usable in case the suspension is lifted
+	if rejectRestrictedUser(writer, user) {
 		return
 	}
 
-	access_token, err := auth.MakeJWT(refresh_token.UserID, cfg.jwt_secret, time.Hour)
+	err = qtx.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(new_refresh_token), UserID: refresh_token.UserID, ExpiresAt: time.Now().AddDate(0, 0, 60), FamilyID: refresh_token.FamilyID,
+		UserAgent: req.UserAgent(), IpAddress: clientIP(req),
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Rotate Refresh Token", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Rotate Refresh Token", err)
+		return
+	}
+
+	access_token, err := auth.MakeJWT(user.ID, refresh_token.FamilyID, user.Role, cfg.jwt_keys, accessTokenTTL)
 	if err != nil {
 		respondWithError(writer, 401, "Unable to Make JWT", err)
 		return
 	}
 
 	type Response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
-	response := Response{Token: access_token}
+	response := Response{Token: access_token, RefreshToken: new_refresh_token}
 
 	respondWithJSON(writer, 200, response)
 }
 
+// rejectRefreshToken explains why a refresh token could not be rotated. A
+// token that was already rotated is being replayed, so its whole family is
+// revoked in case it was stolen.
+func (cfg *apiConfig) rejectRefreshToken(writer http.ResponseWriter, req *http.Request, token string) {
+	refresh_token, err := cfg.db.GetRefreshToken(req.Context(), auth.HashToken(token))
+	if err != nil {
+		respondWithError(writer, 401, "Unable to Get Refresh Token from Database", err)
+		return
+	}
+
+	if refresh_token.ReplacedBy.Valid {
+		err = cfg.db.RevokeRefreshTokenFamily(req.Context(), refresh_token.FamilyID)
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Revoke Token Family", err)
+			return
+		}
+		log.Printf("Refresh token reuse detected for user %s, revoked family %s", refresh_token.UserID, refresh_token.FamilyID)
+		respondWithError(writer, 401, "Refresh Token Reuse Detected", nil)
+		return
+	}
+
+	if refresh_token.RevokedAt.Valid {
+		respondWithError(writer, 401, "Refresh Token is Revoked", nil)
+		return
+	}
+
+	respondWithError(writer, 401, "Refresh Token is Expired", nil)
+}
+
 func (cfg *apiConfig) handlerRevoke(writer http.ResponseWriter, req *http.Request) {
 	token, err := auth.GetBearerToken(req.Header)
 	if err != nil {
@@ -378,7 +891,7 @@ func (cfg *apiConfig) handlerRevoke(writer http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	err = cfg.db.RevokeRefreshToken(req.Context(), token)
+	err = cfg.db.RevokeRefreshToken(req.Context(), auth.HashToken(token))
 	if err != nil {
 		respondWithError(writer, 401, "Unable to Revoke Token. Does Not Exist.", err)
 		return
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+	"github.com/jja42/chirpy/internal/mailer"
+)
+
+// handlerDeleteAccount schedules the caller's account for deletion. Nothing
+// is removed until the grace period ends, so the user can change their mind.
+func (cfg *apiConfig) handlerDeleteAccount(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	type Parameters struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	if user.DeletionScheduledAt.Valid {
+		respondWithError(writer, 409, "Account Deletion Already Scheduled", nil)
+		return
+	}
+
+	_, err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	if err != nil {
+		respondWithError(writer, 401, "Incorrect Password", err)
+		return
+	}
+
+	if user.TotpEnabled {
+		valid, err := cfg.checkSecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Check Authentication Code", err)
+			return
+		}
+		if !valid {
+			respondWithError(writer, 401, "Invalid Authentication Code", nil)
+			return
+		}
+	}
+
+	deletion_time := time.Now().Add(cfg.deletion_grace_period)
+
+	user, err = cfg.db.ScheduleUserDeletion(req.Context(), database.ScheduleUserDeletionParams{
+		ID: user.ID, DeletionScheduledAt: sql.NullTime{Time: deletion_time, Valid: true},
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Schedule Account Deletion", err)
+		return
+	}
+
+	//Keep only this session so the user can still cancel from here
+	err = cfg.db.RevokeOtherUserSessions(req.Context(), database.RevokeOtherUserSessionsParams{UserID: user.ID, FamilyID: claims.SessionID})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Revoke Sessions", err)
+		return
+	}
+
+	body := fmt.Sprintf("Your Chirpy account is scheduled to be deleted on %s.\n\nIf you didn't ask for this, log in and cancel it with DELETE /api/users/me/deletion before then.",
+		deletion_time.UTC().Format("January 2, 2006 15:04 MST"))
+
+	err = cfg.mailer.Send(req.Context(), mailer.Message{To: user.Email, Subject: "Your Chirpy account will be deleted", Body: body})
+	if err != nil {
+		log.Printf("Error sending deletion email: %s", err)
+	}
+
+	respondWithJSON(writer, 202, newUserResponse(user))
+}
+
+func (cfg *apiConfig) handlerCancelAccountDeletion(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	cancelled, err := cfg.db.CancelUserDeletion(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Cancel Account Deletion", err)
+		return
+	}
+
+	if cancelled == 0 {
+		respondWithError(writer, 404, "No Account Deletion Scheduled", nil)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
+
+// purgeDeletedUsers hard-deletes accounts whose grace period is over. Their
+// likes are taken off the like counts first. Their chirps and refresh tokens
+// go with them through ON DELETE CASCADE, along with plain rechirps of their
+// chirps. Chirps that other people replied to or quoted are kept as
+// tombstones with no author, the same way purgeDeletedChirps keeps them, so
+// threads and quotes stay connected.
+func (cfg *apiConfig) purgeDeletedUsers(ctx context.Context) error {
+	user_ids, err := cfg.db.GetUsersDueForPurge(ctx)
+	if err != nil {
+		return err
+	}
+
+	purged := 0
+	for _, user_id := range user_ids {
+		deleted, err := cfg.purgeDeletedUser(ctx, user_id)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			purged++
+		}
+	}
+	if purged > 0 {
+		log.Printf("Purged %d deleted accounts", purged)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) purgeDeletedUser(ctx context.Context, user_id uuid.UUID) (bool, error) {
+	tx, err := cfg.db_conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	//Cascading the likes away would leave the counts too high
+	err = qtx.PurgeUserLikes(ctx, user_id)
+	if err != nil {
+		return false, err
+	}
+
+	err = qtx.PurgeUserChirpRevisions(ctx, user_id)
+	if err != nil {
+		return false, err
+	}
+
+	//Plain rechirps of the user's chirps would be left pointing at nothing
+	err = qtx.PurgeUserRechirps(ctx, user_id)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = qtx.TombstoneUserChirps(ctx, user_id)
+	if err != nil {
+		return false, err
+	}
+
+	//The deletion may have been cancelled since the user was picked
+	deleted, err := qtx.PurgeDeletedUser(ctx, user_id)
+	if err != nil {
+		return false, err
+	}
+	if deleted == 0 {
+		return false, nil
+	}
+
+	return true, tx.Commit()
+}
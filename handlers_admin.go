@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+type claimsContextKey struct{}
+
+// claimsFromContext returns the claims stored by middlewareRequireRole.
+func claimsFromContext(ctx context.Context) auth.Claims {
+	claims, _ := ctx.Value(claimsContextKey{}).(auth.Claims)
+	return claims
+}
+
+// middlewareRequireRole only lets through requests from a login session whose
+// role is at least role. The claims are passed on in the request context.
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		claims, ok := cfg.authenticateRequest(writer, req)
+		if !ok {
+			return
+		}
+
+		if !claims.HasRole(role) {
+			respondWithError(writer, 403, "Access Forbidden", nil)
+			return
+		}
+
+		next.ServeHTTP(writer, req.WithContext(context.WithValue(req.Context(), claimsContextKey{}, claims)))
+	})
+}
+
+func (cfg *apiConfig) handlerSetUserRole(writer http.ResponseWriter, req *http.Request) {
+	claims := claimsFromContext(req.Context())
+
+	id_string := req.PathValue("id")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse User ID from Path Value", err)
+		return
+	}
+
+	type Parameters struct {
+		Role string `json:"role"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	if !auth.ValidRole(params.Role) {
+		respondWithError(writer, 400, "Unknown Role", nil)
+		return
+	}
+
+	//Stops the last admin from locking everyone out
+	if id == claims.UserID && params.Role != auth.RoleAdmin {
+		respondWithError(writer, 409, "Admins Cannot Demote Themselves", nil)
+		return
+	}
+
+	user, err := cfg.db.SetUserRole(req.Context(), database.SetUserRoleParams{ID: id, Role: params.Role})
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	//Access tokens carry the old role until they expire, so end the sessions
+	if id != claims.UserID {
+		err = cfg.db.RevokeUserRefreshTokens(req.Context(), user.ID)
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Revoke Sessions", err)
+			return
+		}
+	}
+
+	respondWithJSON(writer, 200, newUserResponse(user))
+}
+
+// bootstrapAdmin promotes the account named by BOOTSTRAP_ADMIN_EMAIL, but only
+// once its email is verified and only while there is no admin at all.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context) {
+	if cfg.bootstrap_admin_email == "" {
+		return
+	}
+
+	promoted, err := cfg.db.BootstrapAdmin(ctx, cfg.bootstrap_admin_email)
+	if err != nil {
+		log.Printf("Error bootstrapping admin: %s", err)
+		return
+	}
+	if promoted > 0 {
+		log.Printf("Promoted %s to admin", cfg.bootstrap_admin_email)
+	}
+}
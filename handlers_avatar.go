@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/avatar"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+const maxAvatarBytes = 5 << 20
+
+var avatarContentTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/webp": true}
+
+// avatarKey names one thumbnail. Every upload gets a fresh version, so the
+// files never change once written and can be cached indefinitely.
+func avatarKey(user_id uuid.UUID, version string, size int) string {
+	return fmt.Sprintf("%s/%s-%d.png", user_id, version, size)
+}
+
+func (cfg *apiConfig) handlerUploadAvatar(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+
+	//Leave room for the multipart framing around the file itself
+	req.Body = http.MaxBytesReader(writer, req.Body, maxAvatarBytes+64<<10)
+
+	file, header, err := req.FormFile("avatar")
+	if err != nil {
+		var max_bytes_err *http.MaxBytesError
+		if errors.As(err, &max_bytes_err) {
+			respondWithError(writer, 413, "Avatar is Too Large", err)
+			return
+		}
+		respondWithError(writer, 400, "Unable to Read Avatar", err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxAvatarBytes {
+		respondWithError(writer, 413, "Avatar is Too Large", nil)
+		return
+	}
+
+	//Trust the bytes rather than the client's Content-Type header
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		respondWithError(writer, 400, "Unable to Read Avatar", err)
+		return
+	}
+	content_type := http.DetectContentType(sniff[:n])
+	if !avatarContentTypes[content_type] {
+		respondWithError(writer, 415, "Avatar Must be a PNG, JPEG or WebP Image", nil)
+		return
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Read Avatar", err)
+		return
+	}
+
+	thumbnails, err := avatar.Process(file)
+	if errors.Is(err, avatar.ErrTooLarge) {
+		respondWithError(writer, 413, "Avatar Dimensions are Too Large", err)
+		return
+	}
+	if err != nil {
+		respondWithError(writer, 400, "Unable to Decode Avatar", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	version := strings.ReplaceAll(uuid.New().String(), "-", "")
+	for size, data := range thumbnails {
+		err = cfg.avatar_store.Put(req.Context(), avatarKey(user.ID, version, size), bytes.NewReader(data))
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Store Avatar", err)
+			return
+		}
+	}
+
+	largest := avatar.Sizes[len(avatar.Sizes)-1]
+	avatar_url := "/avatars/" + avatarKey(user.ID, version, largest)
+
+	updated, err := cfg.db.PatchUser(req.Context(), database.PatchUserParams{
+		ID: user.ID, AvatarUrl: sql.NullString{String: avatar_url, Valid: true},
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Update Avatar", err)
+		return
+	}
+
+	cfg.deleteOldAvatar(req, user)
+
+	respondWithJSON(writer, 200, newUserResponse(updated))
+}
+
+// deleteOldAvatar removes the thumbnails of an avatar that has just been
+// replaced. Links to outside images are left alone.
+func (cfg *apiConfig) deleteOldAvatar(req *http.Request, user database.User) {
+	prefix := fmt.Sprintf("/avatars/%s/", user.ID)
+	if !strings.HasPrefix(user.AvatarUrl, prefix) {
+		return
+	}
+
+	name := strings.TrimPrefix(user.AvatarUrl, prefix)
+	version, _, found := strings.Cut(name, "-")
+	if !found {
+		return
+	}
+
+	for _, size := range avatar.Sizes {
+		err := cfg.avatar_store.Delete(req.Context(), avatarKey(user.ID, version, size))
+		if err != nil {
+			log.Printf("Error deleting old avatar: %s", err)
+		}
+	}
+}
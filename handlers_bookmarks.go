@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerBookmarkChirp(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "Chirp Not Found", err)
+		return
+	}
+
+	//Bookmarking a plain rechirp saves the original
+	if chirp.RechirpOf.Valid && !chirp.IsQuote {
+		chirp, err = cfg.db.GetChirp(req.Context(), chirp.RechirpOf.UUID)
+		if err != nil {
+			respondWithError(writer, 404, "Chirp Not Found", err)
+			return
+		}
+	}
+
+	//Bookmarking twice is harmless
+	_, err = cfg.db.CreateBookmark(req.Context(), database.CreateBookmarkParams{UserID: claims.UserID, ChirpID: chirp.ID})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Bookmark Chirp", err)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
+
+// handlerRemoveBookmark also works for chirps that no longer exist, so
+// unavailable bookmarks can be cleared out.
+func (cfg *apiConfig) handlerRemoveBookmark(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	removed, err := cfg.db.DeleteBookmark(req.Context(), database.DeleteBookmarkParams{UserID: claims.UserID, ChirpID: id})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Remove Bookmark", err)
+		return
+	}
+
+	if removed == 0 {
+		respondWithError(writer, 404, "Bookmark Not Found", nil)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
+
+// handlerGetBookmarks lists the caller's bookmarks, most recent first. They
+// are private, so there is no way to read anyone else's.
+func (cfg *apiConfig) handlerGetBookmarks(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeProfileRead)
+	if !ok {
+		return
+	}
+
+	query := req.URL.Query()
+
+	limit, ok := parsePageLimit(writer, query)
+	if !ok {
+		return
+	}
+
+	//One extra row tells us whether there is another page
+	params := database.GetUserBookmarksParams{UserID: claims.UserID, Limit: limit + 1}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		created_at, chirp_id, err := decodeChirpCursor(cursor)
+		if err != nil {
+			respondWithError(writer, 400, "Invalid Cursor", err)
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: created_at, Valid: true}
+		params.BeforeChirpID = uuid.NullUUID{UUID: chirp_id, Valid: true}
+	}
+
+	bookmarks, err := cfg.db.GetUserBookmarks(req.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Bookmarks", err)
+		return
+	}
+
+	next_cursor := ""
+	if len(bookmarks) == int(params.Limit) {
+		bookmarks = bookmarks[:len(bookmarks)-1]
+		last := bookmarks[len(bookmarks)-1]
+		next_cursor = encodeChirpCursor(last.CreatedAt, last.ChirpID)
+	}
+
+	chirp_ids := []uuid.UUID{}
+	for _, bookmark := range bookmarks {
+		chirp_ids = append(chirp_ids, bookmark.ChirpID)
+	}
+
+	//Deleted and purged chirps are left out and their bookmarks shown as unavailable
+	found, err := cfg.db.GetChirpsByIDs(req.Context(), chirp_ids)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Bookmarks", err)
+		return
+	}
+
+	chirps := []database.Chirp{}
+	for _, chirp := range found {
+		if !chirp.DeletedAt.Valid {
+			chirps = append(chirps, chirp)
+		}
+	}
+
+	Chirps, err := cfg.chirpResponses(req.Context(), claims.UserID, chirps)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Bookmarks", err)
+		return
+	}
+
+	available := map[uuid.UUID]ChirpResponse{}
+	for _, chirp := range Chirps {
+		available[chirp.ID] = chirp
+	}
+
+	Bookmarks := []BookmarkResponse{}
+	for _, bookmark := range bookmarks {
+		response := BookmarkResponse{ChirpID: bookmark.ChirpID, BookmarkedAt: bookmark.CreatedAt}
+		if chirp, ok := available[bookmark.ChirpID]; ok {
+			response.Available = true
+			response.Chirp = &chirp
+		}
+		Bookmarks = append(Bookmarks, response)
+	}
+
+	respondWithJSON(writer, 200, BookmarkPageResponse{Bookmarks: Bookmarks, NextCursor: next_cursor})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+// Chirpy Red members get longer to fix their typos.
+const (
+	chirpEditWindow    = 15 * time.Minute
+	chirpRedEditWindow = 24 * time.Hour
+)
+
+func chirpEditWindowFor(user database.User) time.Duration {
+	if user.IsChirpyRed {
+		return chirpRedEditWindow
+	}
+	return chirpEditWindow
+}
+
+// handlerUpdateChirp replaces the body of a chirp, keeping the old body as a
+// revision. Only the author can edit, and only within their edit window.
+func (cfg *apiConfig) handlerUpdateChirp(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 401, "Unauthorized Request", err)
+		return
+	}
+
+	if !user.EmailVerified {
+		respondWithError(writer, 403, "Email Not Verified", nil)
+		return
+	}
+
+	type Parameters struct {
+		Body string `json:"body"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	cleaned_body, ok := cleanChirpBody(writer, params.Body)
+	if !ok {
+		return
+	}
+
+	//Lock the chirp so concurrent edits can't lose a revision
+	tx, err := cfg.db_conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Update Chirp", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.GetChirpForUpdate(req.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, 404, "Chirp Not Found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Update Chirp", err)
+		return
+	}
+
+	if chirp.UserID.UUID != user.ID {
+		respondWithError(writer, 403, "User is not Chirp Author", nil)
+		return
+	}
+
+	if chirp.RechirpOf.Valid && !chirp.IsQuote {
+		respondWithError(writer, 400, "Plain Rechirps Cannot Be Edited", nil)
+		return
+	}
+
+	if chirp.RechirpOf.Valid && cleaned_body == "" {
+		respondWithError(writer, 400, "Quote Commentary Cannot Be Empty", nil)
+		return
+	}
+
+	if time.Since(chirp.CreatedAt) > chirpEditWindowFor(user) {
+		respondWithError(writer, 403, "Edit Window Has Closed", nil)
+		return
+	}
+
+	//Saving the same text again is not a new revision
+	if cleaned_body != chirp.Body {
+		err = qtx.CreateChirpRevision(req.Context(), database.CreateChirpRevisionParams{
+			ChirpID: chirp.ID, Body: chirp.Body, WrittenAt: chirp.UpdatedAt,
+		})
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Update Chirp", err)
+			return
+		}
+
+		chirp, err = qtx.UpdateChirpBody(req.Context(), database.UpdateChirpBodyParams{ID: chirp.ID, Body: cleaned_body})
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Update Chirp", err)
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Update Chirp", err)
+			return
+		}
+	}
+
+	response, err := cfg.chirpResponses(req.Context(), user.ID, []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Update Chirp", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, response[0])
+}
+
+func (cfg *apiConfig) handlerGetChirpRevisions(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	_, err = cfg.db.GetChirp(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "Chirp Not Found", err)
+		return
+	}
+
+	revisions, err := cfg.db.GetChirpRevisions(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Revisions", err)
+		return
+	}
+
+	Revisions := []RevisionResponse{}
+	for _, revision := range revisions {
+		Revisions = append(Revisions, RevisionResponse{
+			ID: revision.ID, Body: revision.Body, WrittenAt: revision.WrittenAt, ReplacedAt: revision.ReplacedAt,
+		})
+	}
+
+	respondWithJSON(writer, 200, Revisions)
+}
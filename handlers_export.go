@@ -0,0 +1,324 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+const (
+	exportRetention    = 7 * 24 * time.Hour
+	exportLinkDuration = 15 * time.Minute
+	exportBuildTimeout = 10 * time.Minute
+)
+
+func exportSignatureMessage(id uuid.UUID, expires int64) string {
+	return fmt.Sprintf("export:%s:%d", id, expires)
+}
+
+// exportDownloadURL returns a link that works without an access token until
+// it expires, so it can be opened straight from a browser.
+func (cfg *apiConfig) exportDownloadURL(export database.DataExport) string {
+	expires := time.Now().Add(exportLinkDuration)
+	if export.ExpiresAt.Valid && export.ExpiresAt.Time.Before(expires) {
+		expires = export.ExpiresAt.Time
+	}
+
+	values := url.Values{}
+	values.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	values.Set("signature", auth.SignMessage(cfg.export_signing_key, exportSignatureMessage(export.ID, expires.Unix())))
+
+	return fmt.Sprintf("/api/exports/%s/download?%s", export.ID, values.Encode())
+}
+
+func (cfg *apiConfig) handlerRequestExport(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	pending, err := cfg.db.HasPendingDataExport(req.Context(), database.HasPendingDataExportParams{
+		UserID: claims.UserID, CreatedAt: time.Now().Add(-exportBuildTimeout),
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Create Export", err)
+		return
+	}
+	if pending {
+		respondWithError(writer, 409, "An Export is Already in Progress", nil)
+		return
+	}
+
+	export, err := cfg.db.CreateDataExport(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Create Export", err)
+		return
+	}
+
+	//The archive is built in the background; clients poll for the link
+	go cfg.buildDataExport(export)
+
+	respondWithJSON(writer, 202, ExportResponse{ID: export.ID, Status: export.Status, CreatedAt: export.CreatedAt})
+}
+
+func (cfg *apiConfig) handlerGetExport(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	id_string := req.PathValue("id")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Export ID from Path Value", err)
+		return
+	}
+
+	export, err := cfg.db.GetDataExport(req.Context(), id)
+	if err != nil || export.UserID != claims.UserID {
+		respondWithError(writer, 404, "Export Not Found", err)
+		return
+	}
+
+	response := ExportResponse{ID: export.ID, Status: export.Status, CreatedAt: export.CreatedAt}
+	if export.ExpiresAt.Valid {
+		response.ExpiresAt = &export.ExpiresAt.Time
+	}
+	if export.Status == "ready" {
+		response.DownloadURL = cfg.exportDownloadURL(export)
+	}
+
+	respondWithJSON(writer, 200, response)
+}
+
+func (cfg *apiConfig) handlerDownloadExport(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("id")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Export ID from Path Value", err)
+		return
+	}
+
+	expires, err := strconv.ParseInt(req.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		respondWithError(writer, 403, "Invalid Download Link", err)
+		return
+	}
+
+	if !auth.CheckMessageSignature(cfg.export_signing_key, exportSignatureMessage(id, expires), req.URL.Query().Get("signature")) {
+		respondWithError(writer, 403, "Invalid Download Link", nil)
+		return
+	}
+
+	if time.Now().Unix() > expires {
+		respondWithError(writer, 410, "Download Link Has Expired", nil)
+		return
+	}
+
+	export, err := cfg.db.GetDataExport(req.Context(), id)
+	if err != nil || export.Status != "ready" || !export.FilePath.Valid {
+		respondWithError(writer, 404, "Export Not Found", err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/zip")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"chirpy-export-%s.zip\"", export.ID))
+	writer.Header().Set("Cache-Control", "private, no-store")
+	http.ServeFile(writer, req, export.FilePath.String)
+}
+
+// buildDataExport writes the archive for export and records the outcome.
+func (cfg *apiConfig) buildDataExport(export database.DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportBuildTimeout)
+	defer cancel()
+
+	path := filepath.Join(cfg.export_dir, export.ID.String()+".zip")
+
+	err := cfg.writeDataExport(ctx, export.UserID, path)
+	if err != nil {
+		log.Printf("Error building export %s: %s", export.ID, err)
+		os.Remove(path)
+		//Failed exports are cleaned up like finished ones
+		err = cfg.db.FailDataExport(ctx, database.FailDataExportParams{
+			ID: export.ID, ExpiresAt: sql.NullTime{Time: time.Now().Add(exportRetention), Valid: true},
+		})
+		if err != nil {
+			log.Printf("Error marking export %s as failed: %s", export.ID, err)
+		}
+		return
+	}
+
+	err = cfg.db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID: export.ID, FilePath: sql.NullString{String: path, Valid: true},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(exportRetention), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error completing export %s: %s", export.ID, err)
+	}
+}
+
+func (cfg *apiConfig) writeDataExport(ctx context.Context, user_id uuid.UUID, path string) error {
+	user, err := cfg.db.GetUserByID(ctx, user_id)
+	if err != nil {
+		return err
+	}
+
+	//Chirps in the trash can still be restored, so they belong to the user too
+	chirps, err := cfg.db.GetAuthorChirpsWithTrash(ctx, database.GetAuthorChirpsWithTrashParams{
+		UserID: user_id, DeletedAfter: time.Now().Add(-cfg.chirp_trash_window),
+	})
+	if err != nil {
+		return err
+	}
+
+	sessions, err := cfg.db.GetUserSessions(ctx, user_id)
+	if err != nil {
+		return err
+	}
+
+	type ExportedChirp struct {
+		ChirpResponse
+		DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	}
+
+	Chirps := []ExportedChirp{}
+	for _, chirp := range chirps {
+		response := ExportedChirp{ChirpResponse: ChirpResponse{
+			ID:           chirp.ID,
+			CreatedAt:    chirp.CreatedAt,
+			UpdatedAt:    chirp.UpdatedAt,
+			Body:         chirp.Body,
+			UserID:       chirp.UserID.UUID,
+			AuthorHandle: user.Handle.String,
+		}}
+		if chirp.ParentID.Valid {
+			response.InReplyTo = &chirp.ParentID.UUID
+		}
+		if chirp.DeletedAt.Valid {
+			response.Deleted = true
+			response.DeletedAt = &chirp.DeletedAt.Time
+		}
+		Chirps = append(Chirps, response)
+	}
+
+	Sessions := []SessionResponse{}
+	for _, session := range sessions {
+		Sessions = append(Sessions, SessionResponse{
+			ID:         session.FamilyID,
+			CreatedAt:  session.StartedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+		})
+	}
+
+	type ChirpyRed struct {
+		IsChirpyRed bool `json:"is_chirpy_red"`
+	}
+
+	files := []struct {
+		name    string
+		payload interface{}
+	}{
+		{"profile.json", newUserResponse(user)},
+		{"chirps.json", Chirps},
+		{"sessions.json", Sessions},
+		{"chirpy_red.json", ChirpyRed{IsChirpyRed: user.IsChirpyRed}},
+	}
+
+	//Write to a temporary name so a half-built archive is never served
+	tmp_path := path + ".tmp"
+	file, err := os.OpenFile(tmp_path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp_path)
+
+	archive := zip.NewWriter(file)
+	for _, f := range files {
+		entry, err := archive.Create(f.name)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(f.payload)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp_path, path)
+}
+
+// cleanupDataExports deletes expired archives along with their rows, plus any
+// stray files left behind by accounts that have since been deleted.
+func (cfg *apiConfig) cleanupDataExports(ctx context.Context) error {
+	//Builds interrupted by a restart never finish on their own
+	err := cfg.db.FailStaleDataExports(ctx, time.Now().Add(-exportBuildTimeout))
+	if err != nil {
+		return err
+	}
+
+	exports, err := cfg.db.GetExpiredDataExports(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.FilePath.Valid {
+			err = os.Remove(export.FilePath.String)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err = cfg.db.DeleteDataExport(ctx, export.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(cfg.export_dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > exportRetention {
+			os.Remove(filepath.Join(cfg.export_dir, entry.Name()))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerLikeChirp(writer http.ResponseWriter, req *http.Request) {
+	cfg.setChirpLike(writer, req, true)
+}
+
+func (cfg *apiConfig) handlerUnlikeChirp(writer http.ResponseWriter, req *http.Request) {
+	cfg.setChirpLike(writer, req, false)
+}
+
+// setChirpLike adds or removes the caller's like. The like row and the
+// chirp's like_count change in one transaction, and the count is only moved
+// when the like row actually changed, so repeated or concurrent requests
+// can't skew it.
+func (cfg *apiConfig) setChirpLike(writer http.ResponseWriter, req *http.Request, like bool) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "Chirp Not Found", err)
+		return
+	}
+
+	//Likes on a plain rechirp count for the original
+	if chirp.RechirpOf.Valid && !chirp.IsQuote {
+		chirp, err = cfg.db.GetChirp(req.Context(), chirp.RechirpOf.UUID)
+		if err != nil {
+			respondWithError(writer, 404, "Chirp Not Found", err)
+			return
+		}
+	}
+
+	tx, err := cfg.db_conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Update Like", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	var changed int64
+	var delta int32
+	if like {
+		changed, err = qtx.CreateLike(req.Context(), database.CreateLikeParams{UserID: claims.UserID, ChirpID: chirp.ID})
+		delta = 1
+	} else {
+		changed, err = qtx.DeleteLike(req.Context(), database.DeleteLikeParams{UserID: claims.UserID, ChirpID: chirp.ID})
+		delta = -1
+	}
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Update Like", err)
+		return
+	}
+
+	if changed > 0 {
+		chirp, err = qtx.AddToLikeCount(req.Context(), database.AddToLikeCountParams{ID: chirp.ID, Delta: delta})
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Update Like", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Update Like", err)
+		return
+	}
+
+	response, err := cfg.chirpResponses(req.Context(), claims.UserID, []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Update Like", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, response[0])
+}
+
+// handlerGetUserLikes lists the chirps a user has liked, most recent like
+// first. The user can be given by ID or handle.
+func (cfg *apiConfig) handlerGetUserLikes(writer http.ResponseWriter, req *http.Request) {
+	var user_id uuid.UUID
+
+	id_string := req.PathValue("id")
+	id, err := uuid.Parse(id_string)
+	if err == nil {
+		user_id = id
+	} else {
+		user, err := cfg.db.GetUserByHandle(req.Context(), normalizeHandle(id_string))
+		if err != nil {
+			respondWithError(writer, 404, "User Not Found", err)
+			return
+		}
+		user_id = user.ID
+	}
+
+	query := req.URL.Query()
+
+	limit, ok := parsePageLimit(writer, query)
+	if !ok {
+		return
+	}
+
+	//One extra row tells us whether there is another page
+	params := database.GetUserLikesParams{UserID: user_id, Limit: limit + 1}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		liked_at, chirp_id, err := decodeChirpCursor(cursor)
+		if err != nil {
+			respondWithError(writer, 400, "Invalid Cursor", err)
+			return
+		}
+		params.BeforeLikedAt = sql.NullTime{Time: liked_at, Valid: true}
+		params.BeforeChirpID = uuid.NullUUID{UUID: chirp_id, Valid: true}
+	}
+
+	rows, err := cfg.db.GetUserLikes(req.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Likes", err)
+		return
+	}
+
+	next_cursor := ""
+	if len(rows) == int(params.Limit) {
+		rows = rows[:len(rows)-1]
+		last := rows[len(rows)-1]
+		next_cursor = encodeChirpCursor(last.LikedAt, last.Chirp.ID)
+	}
+
+	chirps := []database.Chirp{}
+	for _, row := range rows {
+		chirps = append(chirps, row.Chirp)
+	}
+
+	Chirps, err := cfg.chirpResponses(req.Context(), cfg.viewerID(req), chirps)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Likes", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, ChirpPageResponse{Chirps: Chirps, NextCursor: next_cursor})
+}
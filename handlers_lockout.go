@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jja42/chirpy/internal/lockout"
+)
+
+func loginAccountKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// rejectLockedLogin answers 429 when either the account or the client
+// address is locked out, and reports whether it did.
+func (cfg *apiConfig) rejectLockedLogin(writer http.ResponseWriter, req *http.Request, account_key, ip_key string) bool {
+	account_wait, err := cfg.login_account_limiter.Check(req.Context(), account_key)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Check Login Attempts", err)
+		return true
+	}
+
+	ip_wait, err := cfg.login_ip_limiter.Check(req.Context(), ip_key)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Check Login Attempts", err)
+		return true
+	}
+
+	wait := max(account_wait, ip_wait)
+	if wait == 0 {
+		return false
+	}
+
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(writer, 429, "Too Many Login Attempts", nil)
+	return true
+}
+
+func (cfg *apiConfig) recordLoginFailure(req *http.Request, account_key, ip_key string) {
+	_, err := cfg.login_account_limiter.Fail(req.Context(), account_key)
+	if err != nil {
+		log.Printf("Error recording login failure: %s", err)
+	}
+
+	_, err = cfg.login_ip_limiter.Fail(req.Context(), ip_key)
+	if err != nil {
+		log.Printf("Error recording login failure: %s", err)
+	}
+}
+
+func (cfg *apiConfig) handlerClearLockout(writer http.ResponseWriter, req *http.Request) {
+	email := req.URL.Query().Get("email")
+	ip := req.URL.Query().Get("ip")
+
+	if email == "" && ip == "" {
+		respondWithError(writer, 400, "Email or IP is Required", nil)
+		return
+	}
+
+	if email != "" {
+		err := cfg.login_account_limiter.Reset(req.Context(), loginAccountKey(email))
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Clear Lockout", err)
+			return
+		}
+	}
+
+	if ip != "" {
+		err := cfg.login_ip_limiter.Reset(req.Context(), loginIPKey(ip))
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Clear Lockout", err)
+			return
+		}
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
+
+// Accounts lock quickly; addresses get more room because many users can
+// share one behind a NAT.
+var (
+	loginAccountPolicy = lockout.Policy{Threshold: 5, BaseDelay: 30 * time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+	loginIPPolicy      = lockout.Policy{Threshold: 20, BaseDelay: 30 * time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+)
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+const (
+	mfaChallengeDuration = 5 * time.Minute
+	recoveryCodeCount    = 10
+)
+
+// startMFAChallenge answers a correct password for an account with 2FA. The
+// returned token proves the password step and is exchanged, together with a
+// one-time code, at /api/login/mfa.
+func (cfg *apiConfig) startMFAChallenge(writer http.ResponseWriter, req *http.Request, user database.User) {
+	token := auth.MakeRefreshToken()
+
+	err := cfg.db.CreateMFAChallenge(req.Context(), database.CreateMFAChallengeParams{
+		TokenHash: auth.HashToken(token), UserID: user.ID, ExpiresAt: time.Now().Add(mfaChallengeDuration),
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Start MFA Challenge", err)
+		return
+	}
+
+	type Response struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	respondWithJSON(writer, 200, Response{MFARequired: true, MFAToken: token})
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+// Both are consumed so that neither can be replayed.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, user database.User, code, recovery_code string) (bool, error) {
+	if code != "" && user.TotpSecret.Valid {
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{ID: user.ID, TotpLastStep: step})
+		return used > 0, err
+	}
+
+	if recovery_code != "" {
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recovery_code)), UserID: user.ID,
+		})
+		return used > 0, err
+	}
+
+	return false, nil
+}
+
+func (cfg *apiConfig) handlerLoginMFA(writer http.ResponseWriter, req *http.Request) {
+	type Parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	token_hash := auth.HashToken(params.MFAToken)
+
+	challenge, err := cfg.db.GetMFAChallenge(req.Context(), token_hash)
+	if err != nil {
+		respondWithError(writer, 401, "Invalid or Expired MFA Token", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), challenge.UserID)
+	if err != nil {
+		respondWithError(writer, 401, "Invalid or Expired MFA Token", err)
+		return
+	}
+
+	//Wrong codes count against the same lockout as wrong passwords, otherwise
+	//new challenges would allow unlimited guesses
+	account_key := loginAccountKey(user.Email)
+	ip_key := loginIPKey(clientIP(req))
+
+	if cfg.rejectLockedLogin(writer, req, account_key, ip_key) {
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Check Authentication Code", err)
+		return
+	}
+	if !ok {
+		//A challenge only allows a handful of guesses
+		err = cfg.db.RecordMFAChallengeFailure(req.Context(), token_hash)
+		if err != nil {
+			log.Printf("Error recording MFA failure: %s", err)
+		}
+		cfg.recordLoginFailure(req, account_key, ip_key)
+		respondWithError(writer, 401, "Invalid Authentication Code", nil)
+		return
+	}
+
+	err = cfg.login_account_limiter.Reset(req.Context(), account_key)
+	if err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
+
+	used, err := cfg.db.UseMFAChallenge(req.Context(), token_hash)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Complete MFA Challenge", err)
+		return
+	}
+	if used == 0 {
+		respondWithError(writer, 401, "Invalid or Expired MFA Token", nil)
+		return
+	}
+
+	if rejectRestrictedUser(writer, user) {
+		return
+	}
+
+	cfg.startSession(writer, req, user)
+}
+
+func (cfg *apiConfig) handlerEnrollTOTP(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	if user.TotpEnabled {
+		respondWithError(writer, 409, "Two-Factor Authentication Already Enabled", nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Generate TOTP Secret", err)
+		return
+	}
+
+	//The secret stays inactive until a code from it is confirmed
+	err = cfg.db.SetUserTOTPSecret(req.Context(), database.SetUserTOTPSecretParams{
+		ID: user.ID, TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Save TOTP Secret", err)
+		return
+	}
+
+	type Response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	respondWithJSON(writer, 200, Response{Secret: secret, OTPAuthURI: auth.TOTPURI(secret, "Chirpy", user.Email)})
+}
+
+func (cfg *apiConfig) handlerConfirmTOTP(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	type Parameters struct {
+		Code string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	if user.TotpEnabled {
+		respondWithError(writer, 409, "Two-Factor Authentication Already Enabled", nil)
+		return
+	}
+
+	if !user.TotpSecret.Valid {
+		respondWithError(writer, 400, "Two-Factor Enrollment Not Started", nil)
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+	if !valid {
+		respondWithError(writer, 401, "Invalid Authentication Code", nil)
+		return
+	}
+
+	recovery_codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Generate Recovery Codes", err)
+		return
+	}
+
+	tx, err := cfg.db_conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Enable Two-Factor Authentication", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.EnableUserTOTP(req.Context(), database.EnableUserTOTPParams{ID: user.ID, TotpLastStep: step})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Enable Two-Factor Authentication", err)
+		return
+	}
+
+	err = qtx.DeleteUserRecoveryCodes(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Enable Two-Factor Authentication", err)
+		return
+	}
+
+	for _, code := range recovery_codes {
+		err = qtx.CreateRecoveryCode(req.Context(), database.CreateRecoveryCodeParams{CodeHash: auth.HashToken(code), UserID: user.ID})
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Enable Two-Factor Authentication", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Enable Two-Factor Authentication", err)
+		return
+	}
+
+	type Response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	respondWithJSON(writer, 200, Response{RecoveryCodes: recovery_codes})
+}
+
+func (cfg *apiConfig) handlerDisableTOTP(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	type Parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	if !user.TotpEnabled {
+		respondWithError(writer, 409, "Two-Factor Authentication Not Enabled", nil)
+		return
+	}
+
+	valid, err := cfg.checkSecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Check Authentication Code", err)
+		return
+	}
+	if !valid {
+		respondWithError(writer, 401, "Invalid Authentication Code", nil)
+		return
+	}
+
+	err = cfg.db.DisableUserTOTP(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Disable Two-Factor Authentication", err)
+		return
+	}
+
+	err = cfg.db.DeleteUserRecoveryCodes(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Delete Recovery Codes", err)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
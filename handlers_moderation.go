@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+func isRestrictedUser(user database.User) bool {
+	return user.BannedAt.Valid || (user.SuspendedUntil.Valid && user.SuspendedUntil.Time.After(time.Now()))
+}
+
+// rejectRestrictedUser answers 403 when user is banned or suspended, and
+// reports whether it did.
+func rejectRestrictedUser(writer http.ResponseWriter, user database.User) bool {
+	if !isRestrictedUser(user) {
+		return false
+	}
+
+	if user.BannedAt.Valid {
+		respondWithError(writer, 403, "Account Has Been Banned", nil)
+		return true
+	}
+
+	msg := fmt.Sprintf("Account Suspended Until %s", user.SuspendedUntil.Time.UTC().Format(time.RFC3339))
+	respondWithError(writer, 403, msg, nil)
+	return true
+}
+
+// moderatedUserID parses the {id} path value, refusing the caller's own ID so
+// staff cannot lock themselves out. Only admins can act on other moderators
+// and admins.
+func (cfg *apiConfig) moderatedUserID(writer http.ResponseWriter, req *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse User ID from Path Value", err)
+		return uuid.Nil, false
+	}
+
+	claims := claimsFromContext(req.Context())
+	if id == claims.UserID {
+		respondWithError(writer, 409, "Staff Cannot Moderate Themselves", nil)
+		return uuid.Nil, false
+	}
+
+	if !claims.HasRole(auth.RoleAdmin) {
+		user, err := cfg.db.GetUserByID(req.Context(), id)
+		if err != nil {
+			respondWithError(writer, 404, "User Not Found", err)
+			return uuid.Nil, false
+		}
+		if (auth.Claims{Role: user.Role}).HasRole(auth.RoleModerator) {
+			respondWithError(writer, 403, "Only Admins Can Moderate Staff", nil)
+			return uuid.Nil, false
+		}
+	}
+
+	return id, true
+}
+
+func (cfg *apiConfig) handlerSearchUsers(writer http.ResponseWriter, req *http.Request) {
+	limit := 50
+	limit_string := req.URL.Query().Get("limit")
+	if limit_string != "" {
+		parsed, err := strconv.Atoi(limit_string)
+		if err != nil || parsed < 1 || parsed > 100 {
+			respondWithError(writer, 400, "Limit Must be Between 1 and 100", err)
+			return
+		}
+		limit = parsed
+	}
+
+	offset := 0
+	offset_string := req.URL.Query().Get("offset")
+	if offset_string != "" {
+		parsed, err := strconv.Atoi(offset_string)
+		if err != nil || parsed < 0 {
+			respondWithError(writer, 400, "Invalid Offset", err)
+			return
+		}
+		offset = parsed
+	}
+
+	users, err := cfg.db.SearchUsers(req.Context(), database.SearchUsersParams{
+		Query: req.URL.Query().Get("q"), Limit: int32(limit), Offset: int32(offset),
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Search Users", err)
+		return
+	}
+
+	Users := []AdminUserResponse{}
+	for _, user := range users {
+		Users = append(Users, newAdminUserResponse(user))
+	}
+
+	respondWithJSON(writer, 200, Users)
+}
+
+func (cfg *apiConfig) handlerAdminGetUser(writer http.ResponseWriter, req *http.Request) {
+	id, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse User ID from Path Value", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, newAdminUserResponse(user))
+}
+
+func (cfg *apiConfig) handlerSuspendUser(writer http.ResponseWriter, req *http.Request) {
+	id, ok := cfg.moderatedUserID(writer, req)
+	if !ok {
+		return
+	}
+
+	type Parameters struct {
+		DurationHours int    `json:"duration_hours"`
+		Reason        string `json:"reason"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	if params.DurationHours < 1 {
+		respondWithError(writer, 400, "Suspension Must Last at Least an Hour", nil)
+		return
+	}
+
+	user, err := cfg.db.SuspendUser(req.Context(), database.SuspendUserParams{
+		ID:               id,
+		SuspendedUntil:   sql.NullTime{Time: time.Now().Add(time.Duration(params.DurationHours) * time.Hour), Valid: true},
+		ModerationReason: params.Reason,
+	})
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, newAdminUserResponse(user))
+}
+
+func (cfg *apiConfig) handlerBanUser(writer http.ResponseWriter, req *http.Request) {
+	id, ok := cfg.moderatedUserID(writer, req)
+	if !ok {
+		return
+	}
+
+	type Parameters struct {
+		Reason string `json:"reason"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	user, err := cfg.db.BanUser(req.Context(), database.BanUserParams{ID: id, ModerationReason: params.Reason})
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, newAdminUserResponse(user))
+}
+
+// handlerUnbanUser lifts both bans and suspensions.
+func (cfg *apiConfig) handlerUnbanUser(writer http.ResponseWriter, req *http.Request) {
+	id, ok := cfg.moderatedUserID(writer, req)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.UnbanUser(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, newAdminUserResponse(user))
+}
+
+// handlerForceLogout ends every session the user has. Access tokens already
+// handed out stop working at once because sessions are checked per request.
+func (cfg *apiConfig) handlerForceLogout(writer http.ResponseWriter, req *http.Request) {
+	id, ok := cfg.moderatedUserID(writer, req)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.RevokeUserRefreshTokens(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Revoke Sessions", err)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+	"github.com/jja42/chirpy/internal/mailer"
+)
+
+const passwordResetTokenDuration = 30 * time.Minute
+
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, user database.User) error {
+	//Only the most recent link should work
+	err := cfg.db.ExpireUserPasswordResetTokens(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token := auth.MakeRefreshToken()
+
+	err = cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token), UserID: user.ID, ExpiresAt: time.Now().Add(passwordResetTokenDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\nTo choose a new password, send this token to POST /api/password/reset:\n\n%s\n\nThe token expires in 30 minutes. If you didn't ask for this, you can ignore this email.", token)
+
+	return cfg.mailer.Send(ctx, mailer.Message{To: user.Email, Subject: "Reset your Chirpy password", Body: body})
+}
+
+func (cfg *apiConfig) handlerForgotPassword(writer http.ResponseWriter, req *http.Request) {
+	type Parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	//Always answer the same way so this can't be used to probe for accounts
+	user, err := cfg.db.GetUser(req.Context(), params.Email)
+	if err != nil {
+		respondWithJSON(writer, 204, nil)
+		return
+	}
+
+	err = cfg.sendPasswordResetEmail(req.Context(), user)
+	if err != nil {
+		log.Printf("Error sending password reset email: %s", err)
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
+
+func (cfg *apiConfig) handlerResetPassword(writer http.ResponseWriter, req *http.Request) {
+	type Parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	if params.Password == "" {
+		respondWithError(writer, 400, "Password is Required", nil)
+		return
+	}
+
+	//Tokens are single use, so this both checks and consumes it
+	user_id, err := cfg.db.UsePasswordResetToken(req.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		respondWithError(writer, 401, "Invalid or Expired Reset Token", err)
+		return
+	}
+
+	hashed_password, err := auth.HashPassword(params.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %s", err)
+		respondWithError(writer, 500, "Unable to Reset Password", err)
+		return
+	}
+
+	err = cfg.db.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{ID: user_id, HashedPassword: hashed_password})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Reset Password", err)
+		return
+	}
+
+	//Whoever had the old password should not stay logged in
+	err = cfg.db.RevokeUserRefreshTokens(req.Context(), user_id)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Revoke Sessions", err)
+		return
+	}
+
+	err = cfg.db.RevokeUserPersonalAccessTokens(req.Context(), user_id)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Revoke Tokens", err)
+		return
+	}
+
+	err = cfg.db.ExpireUserPasswordResetTokens(req.Context(), user_id)
+	if err != nil {
+		log.Printf("Error expiring password reset tokens: %s", err)
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
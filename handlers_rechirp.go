@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+// handlerRechirp shares a chirp. Without a comment it is a plain rechirp,
+// which each user can make once per chirp; with one it is a quote chirp.
+func (cfg *apiConfig) handlerRechirp(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 401, "Unauthorized Request", err)
+		return
+	}
+
+	if !user.EmailVerified {
+		respondWithError(writer, 403, "Email Not Verified", nil)
+		return
+	}
+
+	type Parameters struct {
+		Comment string `json:"comment"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	//A plain rechirp doesn't need a body at all
+	err = decoder.Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	comment, ok := cleanChirpBody(writer, params.Comment)
+	if !ok {
+		return
+	}
+
+	original, err := cfg.db.GetChirp(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "Chirp Not Found", err)
+		return
+	}
+
+	//Rechirping a plain rechirp shares the chirp it points at
+	if original.RechirpOf.Valid && !original.IsQuote {
+		original, err = cfg.db.GetChirp(req.Context(), original.RechirpOf.UUID)
+		if err != nil {
+			respondWithError(writer, 404, "Chirp Not Found", err)
+			return
+		}
+	}
+
+	chirp, err := cfg.db.CreateChirp(req.Context(), database.CreateChirpParams{
+		Body: comment, UserID: user.ID, RechirpOf: uuid.NullUUID{UUID: original.ID, Valid: true}, IsQuote: comment != "",
+	})
+	if isUniqueViolation(err) {
+		respondWithError(writer, 409, "Chirp Already Rechirped", err)
+		return
+	}
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Rechirp", err)
+		return
+	}
+
+	response, err := cfg.chirpResponses(req.Context(), user.ID, []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Rechirp", err)
+		return
+	}
+
+	respondWithJSON(writer, 201, response[0])
+}
+
+// handlerUndoRechirp removes the caller's plain rechirp of a chirp. Quote
+// chirps are deleted like any other chirp.
+func (cfg *apiConfig) handlerUndoRechirp(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsDelete)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.db.DeletePlainRechirp(req.Context(), database.DeletePlainRechirpParams{
+		UserID: claims.UserID, RechirpOf: uuid.NullUUID{UUID: id, Valid: true},
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Undo Rechirp", err)
+		return
+	}
+
+	if deleted == 0 {
+		respondWithError(writer, 404, "Rechirp Not Found", nil)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
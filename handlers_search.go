@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/database"
+	"github.com/jja42/chirpy/internal/search"
+)
+
+// handlerSearchChirps runs a full-text search, best matches first. since and
+// until take RFC 3339 times; results are paged like handlerGetChirps.
+func (cfg *apiConfig) handlerSearchChirps(writer http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	tsquery, err := search.ParseQuery(query.Get("q"))
+	if err != nil {
+		respondWithError(writer, 400, "Search Query is Required", err)
+		return
+	}
+
+	limit, ok := parsePageLimit(writer, query)
+	if !ok {
+		return
+	}
+
+	params := database.SearchChirpsParams{HeadlineOptions: search.HeadlineOptions, Query: tsquery, Limit: limit + 1}
+
+	author_id := query.Get("author_id")
+	if author_id != "" {
+		user_id, err := uuid.Parse(author_id)
+		if err != nil {
+			respondWithError(writer, 400, "Unable to Parse Author ID", err)
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: user_id, Valid: true}
+	}
+
+	since := query.Get("since")
+	if since != "" {
+		since_time, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			respondWithError(writer, 400, "Unable to Parse Since Time", err)
+			return
+		}
+		params.Since = sql.NullTime{Time: since_time.UTC(), Valid: true}
+	}
+
+	until := query.Get("until")
+	if until != "" {
+		until_time, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			respondWithError(writer, 400, "Unable to Parse Until Time", err)
+			return
+		}
+		params.Until = sql.NullTime{Time: until_time.UTC(), Valid: true}
+	}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		rank, created_at, id, err := decodeSearchCursor(cursor)
+		if err != nil {
+			respondWithError(writer, 400, "Invalid Cursor", err)
+			return
+		}
+		params.AfterRank = sql.NullFloat64{Float64: float64(rank), Valid: true}
+		params.AfterCreatedAt = sql.NullTime{Time: created_at, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	rows, err := cfg.db.SearchChirps(req.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Search Chirps", err)
+		return
+	}
+
+	next_cursor := ""
+	if len(rows) == int(params.Limit) {
+		rows = rows[:len(rows)-1]
+		last := rows[len(rows)-1]
+		next_cursor = encodeSearchCursor(last.Rank, last.Chirp.CreatedAt, last.Chirp.ID)
+	}
+
+	chirps := []database.Chirp{}
+	for _, row := range rows {
+		chirps = append(chirps, row.Chirp)
+	}
+
+	Chirps, err := cfg.chirpResponses(req.Context(), cfg.viewerID(req), chirps)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Search Chirps", err)
+		return
+	}
+
+	Results := []SearchResultResponse{}
+	for i, row := range rows {
+		Results = append(Results, SearchResultResponse{ChirpResponse: Chirps[i], Rank: row.Rank, Snippet: search.Highlight(row.Snippet)})
+	}
+
+	respondWithJSON(writer, 200, SearchPageResponse{Chirps: Results, NextCursor: next_cursor})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerGetSessions(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	sessions, err := cfg.db.GetUserSessions(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Sessions", err)
+		return
+	}
+
+	Sessions := []SessionResponse{}
+
+	for _, session := range sessions {
+		Sessions = append(Sessions, SessionResponse{
+			ID:         session.FamilyID,
+			CreatedAt:  session.StartedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			Current:    session.FamilyID == claims.SessionID,
+		})
+	}
+
+	respondWithJSON(writer, 200, Sessions)
+}
+
+func (cfg *apiConfig) handlerRevokeSession(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	id_string := req.PathValue("id")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Session ID from Path Value", err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeUserSession(req.Context(), database.RevokeUserSessionParams{FamilyID: id, UserID: claims.UserID})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Revoke Session", err)
+		return
+	}
+
+	if revoked == 0 {
+		respondWithError(writer, 404, "Session Not Found", nil)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
+
+// handlerRevokeOtherSessions logs the user out everywhere except the session
+// making the request.
+func (cfg *apiConfig) handlerRevokeOtherSessions(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.RevokeOtherUserSessions(req.Context(), database.RevokeOtherUserSessionsParams{UserID: claims.UserID, FamilyID: claims.SessionID})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Revoke Sessions", err)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
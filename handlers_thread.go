@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+const (
+	defaultThreadDepth = 10
+	maxThreadDepth     = 50
+)
+
+// handlerGetThread returns a chirp with everything above it in its thread and
+// a page of the replies below it. Deleted chirps that other chirps reply to
+// are shown as tombstones.
+func (cfg *apiConfig) handlerGetThread(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	query := req.URL.Query()
+
+	limit, ok := parsePageLimit(writer, query)
+	if !ok {
+		return
+	}
+
+	max_depth := defaultThreadDepth
+	depth_string := query.Get("max_depth")
+	if depth_string != "" {
+		max_depth, err = strconv.Atoi(depth_string)
+		if err != nil || max_depth < 1 || max_depth > maxThreadDepth {
+			respondWithError(writer, 400, "Max Depth Must be Between 1 and "+strconv.Itoa(maxThreadDepth), err)
+			return
+		}
+	}
+
+	//One extra row tells us whether there is another page
+	params := database.GetChirpDescendantsParams{RootID: id, MaxDepth: int32(max_depth), Limit: limit + 1}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		after_path, err := decodeThreadCursor(cursor)
+		if err != nil {
+			respondWithError(writer, 400, "Invalid Cursor", err)
+			return
+		}
+		params.AfterPath = after_path
+	}
+
+	chirp, err := cfg.db.GetChirp(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "Chirp Not Found", err)
+		return
+	}
+
+	ancestor_rows, err := cfg.db.GetChirpAncestors(req.Context(), id)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Thread", err)
+		return
+	}
+
+	descendant_rows, err := cfg.db.GetChirpDescendants(req.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Thread", err)
+		return
+	}
+
+	next_cursor := ""
+	if len(descendant_rows) == int(params.Limit) {
+		descendant_rows = descendant_rows[:len(descendant_rows)-1]
+		last := descendant_rows[len(descendant_rows)-1]
+		next_cursor = encodeThreadCursor(last.Path)
+	}
+
+	//Convert everything at once so handles and counts take one query each
+	chirps := []database.Chirp{chirp}
+	for _, row := range ancestor_rows {
+		chirps = append(chirps, database.Chirp(row))
+	}
+	for _, row := range descendant_rows {
+		chirps = append(chirps, database.Chirp{
+			ID: row.ID, CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt, Body: row.Body, UserID: row.UserID,
+			SearchVector: row.SearchVector, DeletedAt: row.DeletedAt, ParentID: row.ParentID, RechirpOf: row.RechirpOf,
+			LikeCount: row.LikeCount, IsQuote: row.IsQuote,
+		})
+	}
+
+	Chirps, err := cfg.chirpResponses(req.Context(), cfg.viewerID(req), chirps)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Thread", err)
+		return
+	}
+
+	for i := range chirps {
+		if chirps[i].DeletedAt.Valid {
+			Chirps[i] = tombstone(Chirps[i])
+		}
+	}
+
+	response := ThreadResponse{Chirp: Chirps[0], Ancestors: Chirps[1 : 1+len(ancestor_rows)], Replies: []ThreadReplyResponse{}, NextCursor: next_cursor}
+	for i, row := range descendant_rows {
+		response.Replies = append(response.Replies, ThreadReplyResponse{ChirpResponse: Chirps[1+len(ancestor_rows)+i], Depth: row.Depth})
+	}
+
+	respondWithJSON(writer, 200, response)
+}
+
+// A thread cursor is the path of the last reply on the page: one element per
+// level, each the reply's created_at as YYYYMMDDHH24MISSUS followed by its ID.
+func encodeThreadCursor(path []string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(path, ",")))
+}
+
+func decodeThreadCursor(cursor string) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	path := strings.Split(string(raw), ",")
+	if len(path) > maxThreadDepth {
+		return nil, errors.New("cursor is deeper than any thread page")
+	}
+
+	for _, element := range path {
+		if len(element) != 20+36 {
+			return nil, errors.New("malformed cursor")
+		}
+		_, err = time.Parse("20060102150405", element[:14])
+		if err != nil {
+			return nil, err
+		}
+		_, err = strconv.ParseUint(element[14:20], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		_, err = uuid.Parse(element[20:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return path, nil
+}
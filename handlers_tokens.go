@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+// handlerCreateToken issues a personal access token for scripts and bots. The
+// token itself is only ever returned here.
+func (cfg *apiConfig) handlerCreateToken(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	type Parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		respondWithError(writer, 400, "Token Name is Required", nil)
+		return
+	}
+	if len(name) > 100 {
+		respondWithError(writer, 400, "Token Name is Too Long", nil)
+		return
+	}
+
+	if len(params.Scopes) == 0 {
+		respondWithError(writer, 400, "At Least One Scope is Required", nil)
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !auth.ValidScope(scope) {
+			respondWithError(writer, 400, "Unknown Scope: "+scope, nil)
+			return
+		}
+	}
+	slices.Sort(params.Scopes)
+	scopes := slices.Compact(params.Scopes)
+
+	if params.ExpiresInDays < 0 {
+		respondWithError(writer, 400, "Expiry Cannot Be Negative", nil)
+		return
+	}
+
+	//Zero means the token never expires
+	expires_at := sql.NullTime{}
+	if params.ExpiresInDays > 0 {
+		expires_at = sql.NullTime{Time: time.Now().Add(time.Duration(params.ExpiresInDays) * 24 * time.Hour), Valid: true}
+	}
+
+	token := auth.MakePersonalAccessToken()
+
+	pat, err := cfg.db.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		UserID: claims.UserID, Name: name, TokenHash: auth.HashToken(token), Scopes: scopes, ExpiresAt: expires_at,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Create Token", err)
+		return
+	}
+
+	response := newTokenResponse(pat)
+	response.Token = token
+
+	respondWithJSON(writer, 201, response)
+}
+
+func (cfg *apiConfig) handlerGetTokens(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	pats, err := cfg.db.GetUserPersonalAccessTokens(req.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Tokens", err)
+		return
+	}
+
+	Tokens := []TokenResponse{}
+	for _, pat := range pats {
+		Tokens = append(Tokens, newTokenResponse(pat))
+	}
+
+	respondWithJSON(writer, 200, Tokens)
+}
+
+func (cfg *apiConfig) handlerRevokeToken(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+
+	id_string := req.PathValue("id")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Token ID from Path Value", err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokePersonalAccessToken(req.Context(), database.RevokePersonalAccessTokenParams{ID: id, UserID: claims.UserID})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Revoke Token", err)
+		return
+	}
+
+	if revoked == 0 {
+		respondWithError(writer, 404, "Token Not Found", nil)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
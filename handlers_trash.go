@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+)
+
+// handlerGetTrash lists the caller's deleted chirps that can still be
+// restored, most recently deleted first.
+func (cfg *apiConfig) handlerGetTrash(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsDelete)
+	if !ok {
+		return
+	}
+
+	chirps, err := cfg.db.GetDeletedChirps(req.Context(), database.GetDeletedChirpsParams{
+		UserID: claims.UserID, DeletedAfter: time.Now().Add(-cfg.chirp_trash_window),
+	})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Trash", err)
+		return
+	}
+
+	Chirps, err := cfg.chirpResponses(req.Context(), claims.UserID, chirps)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Get Trash", err)
+		return
+	}
+
+	Trash := []TrashedChirpResponse{}
+	for i, chirp := range chirps {
+		Trash = append(Trash, TrashedChirpResponse{
+			ChirpResponse: Chirps[i],
+			DeletedAt:     chirp.DeletedAt.Time,
+			RestoreUntil:  chirp.DeletedAt.Time.Add(cfg.chirp_trash_window),
+		})
+	}
+
+	respondWithJSON(writer, 200, Trash)
+}
+
+func (cfg *apiConfig) handlerRestoreChirp(writer http.ResponseWriter, req *http.Request) {
+	id_string := req.PathValue("chirpID")
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		respondWithError(writer, 400, "Could Not Parse Chirp ID from Path Value", err)
+		return
+	}
+
+	claims, ok := cfg.authenticateWithScope(writer, req, auth.ScopeChirpsDelete)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.db.RestoreChirp(req.Context(), database.RestoreChirpParams{
+		ID: id, UserID: claims.UserID, DeletedAfter: time.Now().Add(-cfg.chirp_trash_window),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, 404, "Chirp Not Found in Trash", err)
+		return
+	}
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Restore Chirp", err)
+		return
+	}
+
+	response, err := cfg.chirpResponses(req.Context(), claims.UserID, []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Restore Chirp", err)
+		return
+	}
+
+	respondWithJSON(writer, 200, response[0])
+}
+
+// purgeDeletedChirps permanently removes chirps that have been in the trash
+// for longer than the restore window. Chirps that still have replies or
+// quotes keep an empty row as a tombstone so their threads stay connected.
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) error {
+	deleted_before := time.Now().Add(-cfg.chirp_trash_window)
+
+	err := cfg.db.PurgeDeletedChirpRevisions(ctx, deleted_before)
+	if err != nil {
+		return err
+	}
+
+	//Plain rechirps of a purged chirp would point at nothing
+	err = cfg.db.PurgeOrphanedRechirps(ctx, deleted_before)
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.db.ScrubDeletedChirps(ctx, deleted_before)
+	if err != nil {
+		return err
+	}
+
+	purged, err := cfg.db.PurgeDeletedChirps(ctx, deleted_before)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("Purged %d deleted chirps", purged)
+	}
+	return nil
+}
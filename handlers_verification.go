@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jja42/chirpy/internal/auth"
+	"github.com/jja42/chirpy/internal/database"
+	"github.com/jja42/chirpy/internal/mailer"
+)
+
+const verificationTokenDuration = 24 * time.Hour
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token := auth.MakeRefreshToken()
+
+	err := cfg.db.CreateVerificationToken(ctx, database.CreateVerificationTokenParams{
+		TokenHash: auth.HashToken(token), UserID: user.ID, ExpiresAt: time.Now().Add(verificationTokenDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Welcome to Chirpy!\n\nConfirm your email address by sending this token to POST /api/users/verify:\n\n%s\n\nThe token expires in 24 hours.", token)
+
+	return cfg.mailer.Send(ctx, mailer.Message{To: user.Email, Subject: "Verify your Chirpy account", Body: body})
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(writer http.ResponseWriter, req *http.Request) {
+	type Parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := Parameters{}
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(writer, 500, "Unable to Decode JSON", err)
+		return
+	}
+
+	//Tokens are single use, so this both checks and consumes it
+	user_id, err := cfg.db.UseVerificationToken(req.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		respondWithError(writer, 401, "Invalid or Expired Verification Token", err)
+		return
+	}
+
+	user, err := cfg.db.VerifyUserEmail(req.Context(), user_id)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Verify User", err)
+		return
+	}
+
+	//The first admin is whoever proves they own the bootstrap address
+	if cfg.bootstrap_admin_email != "" && strings.EqualFold(user.Email, cfg.bootstrap_admin_email) {
+		cfg.bootstrapAdmin(req.Context())
+		user, err = cfg.db.GetUserByID(req.Context(), user.ID)
+		if err != nil {
+			respondWithError(writer, 500, "Unable to Get User", err)
+			return
+		}
+	}
+
+	user_response := newUserResponse(user)
+
+	respondWithJSON(writer, 200, user_response)
+}
+
+func (cfg *apiConfig) handlerResendVerification(writer http.ResponseWriter, req *http.Request) {
+	claims, ok := cfg.authenticateRequest(writer, req)
+	if !ok {
+		return
+	}
+	user_id := claims.UserID
+
+	user, err := cfg.db.GetUserByID(req.Context(), user_id)
+	if err != nil {
+		respondWithError(writer, 404, "User Not Found", err)
+		return
+	}
+
+	if user.EmailVerified {
+		respondWithError(writer, 409, "Email Already Verified", nil)
+		return
+	}
+
+	//Only the most recent link should work
+	err = cfg.db.ExpireUserVerificationTokens(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Send Verification Email", err)
+		return
+	}
+
+	err = cfg.sendVerificationEmail(req.Context(), user)
+	if err != nil {
+		respondWithError(writer, 500, "Unable to Send Verification Email", err)
+		return
+	}
+
+	respondWithJSON(writer, 204, nil)
+}
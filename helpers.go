@@ -1,10 +1,20 @@
 package main
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jja42/chirpy/internal/database"
+	"github.com/lib/pq"
 )
 
 func replaceProfaneWord(word string) string {
@@ -29,22 +39,327 @@ func replaceProfaneText(text string) string {
 	return cleaned_text
 }
 
+// clientIP returns the address of the peer that sent req, without the port.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// isUniqueViolation reports whether err came from a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 type UserResponse struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token,omitempty"`
-	RefreshToken string    `json:"refresh_token,omitempty"`
-	ChirpyRed    bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Token         string    `json:"token,omitempty"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	ChirpyRed     bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	Handle        string    `json:"handle,omitempty"`
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	AvatarURL     string    `json:"avatar_url"`
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+func newUserResponse(user database.User) UserResponse {
+	user_response := UserResponse{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email,
+		ChirpyRed: user.IsChirpyRed, EmailVerified: user.EmailVerified, Role: user.Role, Handle: user.Handle.String,
+		DisplayName: user.DisplayName, Bio: user.Bio, AvatarURL: user.AvatarUrl}
+
+	if user.DeletionScheduledAt.Valid {
+		user_response.DeletionScheduledAt = &user.DeletionScheduledAt.Time
+	}
+
+	return user_response
+}
+
+// AdminUserResponse adds moderation state to UserResponse for admin tools.
+type AdminUserResponse struct {
+	UserResponse
+	SuspendedUntil   *time.Time `json:"suspended_until"`
+	BannedAt         *time.Time `json:"banned_at"`
+	ModerationReason string     `json:"moderation_reason"`
+}
+
+func newAdminUserResponse(user database.User) AdminUserResponse {
+	response := AdminUserResponse{UserResponse: newUserResponse(user), ModerationReason: user.ModerationReason}
+	if user.SuspendedUntil.Valid {
+		response.SuspendedUntil = &user.SuspendedUntil.Time
+	}
+	if user.BannedAt.Valid {
+		response.BannedAt = &user.BannedAt.Time
+	}
+	return response
+}
+
+// ProfileResponse is what anyone can see about a user. It must never carry
+// the email address.
+type ProfileResponse struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	ChirpyRed   bool      `json:"is_chirpy_red"`
+}
+
+func newProfileResponse(user database.User) ProfileResponse {
+	return ProfileResponse{ID: user.ID, CreatedAt: user.CreatedAt, Handle: user.Handle.String,
+		DisplayName: user.DisplayName, Bio: user.Bio, AvatarURL: user.AvatarUrl, ChirpyRed: user.IsChirpyRed}
+}
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// normalizeHandle strips the @ people tend to type in front of a handle.
+func normalizeHandle(handle string) string {
+	return strings.TrimPrefix(strings.TrimSpace(handle), "@")
 }
 
+func validateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return errors.New("handles are 3 to 30 letters, digits or underscores")
+	}
+	return nil
+}
+
+const maxChirpLength = 140
+
 type ChirpResponse struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Body         string     `json:"body"`
+	UserID       uuid.UUID  `json:"user_id"`
+	AuthorHandle string     `json:"author_handle,omitempty"`
+	InReplyTo    *uuid.UUID `json:"in_reply_to,omitempty"`
+	ReplyCount   int64      `json:"reply_count"`
+	Deleted      bool       `json:"deleted,omitempty"`
+
+	//A plain rechirp has an empty body; a quote adds its own
+	RechirpOf    *ChirpResponse `json:"rechirp_of,omitempty"`
+	IsQuote      bool           `json:"is_quote,omitempty"`
+	RechirpCount int64          `json:"rechirp_count"`
+	QuoteCount   int64          `json:"quote_count"`
+
+	LikeCount int32 `json:"like_count"`
+	LikedByMe bool  `json:"liked_by_me"`
+}
+
+// tombstone hides everything but the position of a deleted chirp that is
+// kept in a thread so its replies still have a parent.
+func tombstone(chirp ChirpResponse) ChirpResponse {
+	return ChirpResponse{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt,
+		InReplyTo: chirp.InReplyTo, ReplyCount: chirp.ReplyCount, RechirpCount: chirp.RechirpCount, QuoteCount: chirp.QuoteCount,
+		LikeCount: chirp.LikeCount, Deleted: true}
+}
+
+// TrashedChirpResponse is a deleted chirp that can still be restored until
+// RestoreUntil.
+type TrashedChirpResponse struct {
+	ChirpResponse
+	DeletedAt    time.Time `json:"deleted_at"`
+	RestoreUntil time.Time `json:"restore_until"`
+}
+
+// ThreadResponse is a chirp in context: the chain of chirps it replies to,
+// oldest first, and one page of its replies in depth-first order.
+type ThreadResponse struct {
+	Ancestors  []ChirpResponse       `json:"ancestors"`
+	Chirp      ChirpResponse         `json:"chirp"`
+	Replies    []ThreadReplyResponse `json:"replies"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// ThreadReplyResponse is a reply within a thread. Direct replies have a depth
+// of 1.
+type ThreadReplyResponse struct {
+	ChirpResponse
+	Depth int32 `json:"depth"`
+}
+
+// BookmarkResponse is a saved chirp. Chirp is left out once the chirp has
+// been deleted, and Available is false.
+type BookmarkResponse struct {
+	ChirpID      uuid.UUID      `json:"chirp_id"`
+	BookmarkedAt time.Time      `json:"bookmarked_at"`
+	Available    bool           `json:"available"`
+	Chirp        *ChirpResponse `json:"chirp,omitempty"`
+}
+
+type BookmarkPageResponse struct {
+	Bookmarks  []BookmarkResponse `json:"bookmarks"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// RevisionResponse is an earlier body of an edited chirp. WrittenAt is when
+// that body was posted and ReplacedAt when an edit replaced it.
+type RevisionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Body       string    `json:"body"`
+	WrittenAt  time.Time `json:"written_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// ChirpPageResponse is one page of a chirp listing. NextCursor is empty on
+// the last page.
+type ChirpPageResponse struct {
+	Chirps     []ChirpResponse `json:"chirps"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// parsePageLimit reads the limit query parameter, falling back to
+// defaultPageSize. When it returns false the error response has already been
+// written.
+func parsePageLimit(writer http.ResponseWriter, query url.Values) (int32, bool) {
+	limit_string := query.Get("limit")
+	if limit_string == "" {
+		return defaultPageSize, true
+	}
+
+	limit, err := strconv.Atoi(limit_string)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		respondWithError(writer, 400, fmt.Sprintf("Limit Must be Between 1 and %d", maxPageSize), err)
+		return 0, false
+	}
+
+	return int32(limit), true
+}
+
+// encodeChirpCursor makes an opaque cursor pointing just past the chirp with
+// the given position in the (created_at, id) ordering.
+func encodeChirpCursor(created_at time.Time, id uuid.UUID) string {
+	raw := created_at.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeChirpCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+
+	return parseCursorPosition(string(raw))
+}
+
+func parseCursorPosition(raw string) (time.Time, uuid.UUID, error) {
+	created_at_string, id_string, found := strings.Cut(raw, "|")
+	if !found {
+		return time.Time{}, uuid.Nil, errors.New("malformed cursor")
+	}
+
+	created_at, err := time.Parse(time.RFC3339Nano, created_at_string)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+
+	id, err := uuid.Parse(id_string)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+
+	return created_at, id, nil
+}
+
+// SearchResultResponse is a chirp matched by a search. Snippet is HTML with
+// the matching words wrapped in <mark> tags.
+type SearchResultResponse struct {
+	ChirpResponse
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type SearchPageResponse struct {
+	Chirps     []SearchResultResponse `json:"chirps"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// encodeSearchCursor is like encodeChirpCursor, but search results are
+// ordered by rank first.
+func encodeSearchCursor(rank float32, created_at time.Time, id uuid.UUID) string {
+	raw := strconv.FormatFloat(float64(rank), 'g', -1, 32) + "|" + created_at.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(cursor string) (float32, time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, err
+	}
+
+	rank_string, rest, found := strings.Cut(string(raw), "|")
+	if !found {
+		return 0, time.Time{}, uuid.Nil, errors.New("malformed cursor")
+	}
+
+	rank, err := strconv.ParseFloat(rank_string, 32)
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, err
+	}
+
+	created_at, id, err := parseCursorPosition(rest)
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, err
+	}
+
+	return float32(rank), created_at, id, nil
+}
+
+type SessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+}
+
+type ExportResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+// TokenResponse describes a personal access token. Token is only filled in
+// when the token is created; after that only its hash is kept.
+type TokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func newTokenResponse(pat database.PersonalAccessToken) TokenResponse {
+	response := TokenResponse{ID: pat.ID, Name: pat.Name, Scopes: pat.Scopes, CreatedAt: pat.CreatedAt}
+	if pat.LastUsedAt.Valid {
+		response.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	if pat.ExpiresAt.Valid {
+		response.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	return response
 }
 
 type PolkaResponse struct {
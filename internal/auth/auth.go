@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -10,61 +12,83 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashed_password, err := bcrypt.GenerateFromPassword([]byte(password), 10)
-	if err != nil {
-		return "", err
-	}
-	return string(hashed_password), nil
+// Claims are the parts of a validated access token that handlers care about.
+// SessionID is set for login sessions; TokenID and Scopes for personal access
+// tokens.
+type Claims struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	Role      string
+	TokenID   uuid.UUID
+	Scopes    []string
 }
 
-func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid"`
+	Role      string `json:"role"`
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// MakeJWT signs an access token with the active key in keys and records the
+// key's kid in the header. The user's role is carried in the "role" claim.
+func MakeJWT(userID, sessionID uuid.UUID, role string, keys *KeySet, expiresIn time.Duration) (string, error) {
+	key, err := keys.signingKey()
+	if err != nil {
+		return "", err
+	}
+
 	currentTime := time.Now()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Issuer: "chirpy",
-		IssuedAt:  jwt.NewNumericDate(currentTime.UTC()),
-		ExpiresAt: jwt.NewNumericDate((currentTime.Add(expiresIn)).UTC()),
-		Subject:   userID.String(),
+	token := jwt.NewWithClaims(key.Method, tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: "chirpy",
+			IssuedAt:  jwt.NewNumericDate(currentTime.UTC()),
+			ExpiresAt: jwt.NewNumericDate((currentTime.Add(expiresIn)).UTC()),
+			Subject:   userID.String(),
+		},
+		SessionID: sessionID.String(),
+		Role:      role,
 	})
+	token.Header["kid"] = key.ID
 
-	return token.SignedString([]byte(tokenSecret))
+	return token.SignedString(key.Private)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// ValidateJWT checks the signature and issuer of an access token against the
+// key named by its kid and returns the user, session and role it was issued
+// for.
+// Callers still need to check that the session hasn't been revoked since.
+func ValidateJWT(tokenString string, keys *KeySet) (Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &tokenClaims{}, keys.keyFunc)
 	if err != nil {
-		return uuid.UUID{}, err
+		return Claims{}, err
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	claims, ok := token.Claims.(*tokenClaims)
 	if !ok {
-		return uuid.UUID{}, errors.New("invalid claims")
+		return Claims{}, errors.New("invalid claims")
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 	if issuer != "chirpy" {
-		return uuid.Nil, errors.New("invalid issuer")
+		return Claims{}, errors.New("invalid issuer")
 	}
 
 	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.UUID{}, err
+		return Claims{}, err
 	}
 
-	return userID, nil
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return Claims{}, errors.New("missing session id")
+	}
+
+	return Claims{UserID: userID, SessionID: sessionID, Role: claims.Role}, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -86,6 +110,31 @@ func MakeRefreshToken() string {
 	return str
 }
 
+// HashToken returns the hex SHA-256 digest of an opaque token so that only
+// the digest has to be stored in the database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SignMessage returns a hex HMAC-SHA256 of message. It backs links that grant
+// access on their own, without an Authorization header.
+func SignMessage(secret []byte, message string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func CheckMessageSignature(secret []byte, message, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	header := headers.Get("Authorization")
 	if header == "" {
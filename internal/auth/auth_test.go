@@ -54,7 +54,7 @@ func TestCheckPasswordHash(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := CheckPasswordHash(tt.password, tt.hash)
+			_, err := CheckPasswordHash(tt.password, tt.hash)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CheckPasswordHash() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -64,33 +64,48 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	sessionID := uuid.New()
+	keys := newHMACKeySet(t, "secret")
+	wrongKeys := newHMACKeySet(t, "wrong_secret")
+	validToken, _ := MakeJWT(userID, sessionID, RoleModerator, keys, time.Hour)
+	expiredToken, _ := MakeJWT(userID, sessionID, RoleUser, keys, -time.Minute)
 
 	tests := []struct {
 		name        string
 		tokenString string
-		tokenSecret string
+		keys        *KeySet
 		wantUserID  uuid.UUID
+		wantSession uuid.UUID
+		wantRole    string
 		wantErr     bool
 	}{
 		{
 			name:        "Valid token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  userID,
+			wantSession: sessionID,
+			wantRole:    RoleModerator,
 			wantErr:     false,
 		},
 		{
 			name:        "Invalid token",
 			tokenString: "invalid.token.string",
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
 			name:        "Wrong secret",
 			tokenString: validToken,
-			tokenSecret: "wrong_secret",
+			keys:        wrongKeys,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			keys:        keys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
@@ -98,14 +113,78 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotClaims, err := ValidateJWT(tt.tokenString, tt.keys)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if gotUserID != tt.wantUserID {
-				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, tt.wantUserID)
+			if gotClaims.UserID != tt.wantUserID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotClaims.UserID, tt.wantUserID)
+			}
+			if gotClaims.SessionID != tt.wantSession {
+				t.Errorf("ValidateJWT() gotSessionID = %v, want %v", gotClaims.SessionID, tt.wantSession)
+			}
+			if gotClaims.Role != tt.wantRole {
+				t.Errorf("ValidateJWT() gotRole = %v, want %v", gotClaims.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token := MakeRefreshToken()
+
+	if HashToken(token) != HashToken(token) {
+		t.Errorf("HashToken() is not deterministic")
+	}
+	if HashToken(token) == token {
+		t.Errorf("HashToken() returned the token unchanged")
+	}
+	if HashToken(token) == HashToken(MakeRefreshToken()) {
+		t.Errorf("HashToken() returned the same digest for different tokens")
+	}
+
+	// Must match encode(sha256(...), 'hex') used by the refresh token migration
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashToken("abc"); got != want {
+		t.Errorf("HashToken(\"abc\") = %s, want %s", got, want)
+	}
+}
+
+func TestMessageSignature(t *testing.T) {
+	secret := []byte("secret")
+	signature := SignMessage(secret, "export:1234:1700000000")
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		message   string
+		signature string
+		want      bool
+	}{
+		{name: "Valid signature", secret: secret, message: "export:1234:1700000000", signature: signature, want: true},
+		{name: "Tampered message", secret: secret, message: "export:1234:1800000000", signature: signature, want: false},
+		{name: "Wrong secret", secret: []byte("other"), message: "export:1234:1700000000", signature: signature, want: false},
+		{name: "Not hex", secret: secret, message: "export:1234:1700000000", signature: "zz", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckMessageSignature(tt.secret, tt.message, tt.signature); got != tt.want {
+				t.Errorf("CheckMessageSignature() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func newHMACKeySet(t *testing.T, secret string) *KeySet {
+	t.Helper()
+	keys := NewKeySet()
+	if err := keys.Add(NewHMACKey("test", []byte(secret))); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetActive("test"); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
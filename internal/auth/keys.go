@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one key in a KeySet. Keys without a private half can only
+// verify tokens; that is how retired keys are kept around.
+type SigningKey struct {
+	ID       string
+	Method   jwt.SigningMethod
+	Private  interface{}
+	Public   interface{}
+	NotAfter time.Time
+}
+
+func NewHMACKey(kid string, secret []byte) SigningKey {
+	return SigningKey{ID: kid, Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+}
+
+func NewRSAKey(kid string, private *rsa.PrivateKey) SigningKey {
+	return SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Private: private, Public: &private.PublicKey}
+}
+
+func NewEd25519Key(kid string, private ed25519.PrivateKey) SigningKey {
+	return SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Private: private, Public: private.Public()}
+}
+
+func (k SigningKey) canSign() bool {
+	return k.Private != nil
+}
+
+func (k SigningKey) expired(now time.Time) bool {
+	return !k.NotAfter.IsZero() && now.After(k.NotAfter)
+}
+
+// KeySet holds the key used to sign new access tokens plus every key that
+// tokens still in circulation may have been signed with. Keys are looked up
+// by the kid header.
+type KeySet struct {
+	mu     sync.RWMutex
+	active string
+	keys   map[string]SigningKey
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: map[string]SigningKey{}}
+}
+
+// Add registers a key for verification. It does not make it the signing key.
+func (ks *KeySet) Add(key SigningKey) error {
+	if key.ID == "" {
+		return errors.New("signing key has no kid")
+	}
+	if key.Method == nil || key.Public == nil {
+		return fmt.Errorf("signing key %s is incomplete", key.ID)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if _, exists := ks.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate kid %s", key.ID)
+	}
+	ks.keys[key.ID] = key
+	return nil
+}
+
+// SetActive selects the key that signs new tokens.
+func (ks *KeySet) SetActive(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown kid %s", kid)
+	}
+	if !key.canSign() {
+		return fmt.Errorf("key %s has no private key", kid)
+	}
+	ks.active = kid
+	return nil
+}
+
+// Rotate makes key the signing key. The previous signing key keeps verifying
+// tokens for retireAfter, which should be at least the access token lifetime,
+// and is dropped after that.
+func (ks *KeySet) Rotate(key SigningKey, retireAfter time.Duration) error {
+	err := ks.Add(key)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	previous, ok := ks.keys[ks.active]
+	if ok {
+		previous.NotAfter = time.Now().Add(retireAfter)
+		ks.keys[previous.ID] = previous
+	}
+	ks.mu.Unlock()
+
+	return ks.SetActive(key.ID)
+}
+
+func (ks *KeySet) signingKey() (SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[ks.active]
+	if !ok {
+		return SigningKey{}, errors.New("no active signing key")
+	}
+	return key, nil
+}
+
+func (ks *KeySet) verificationKey(kid string) (SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	if !ok || key.expired(time.Now()) {
+		return SigningKey{}, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("token has no kid")
+	}
+
+	key, err := ks.verificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	//Never let the token pick a different algorithm than the key was made for
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for kid %s", token.Method.Alg(), kid)
+	}
+
+	return key.Public, nil
+}
+
+// JWK is the public half of a signing key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that other services need to verify tokens.
+// Symmetric keys are secret and never included.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if key.expired(now) {
+			continue
+		}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType: "RSA", KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg(),
+				N: base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType: "OKP", KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg(),
+				Curve: "Ed25519", X: base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+	return jwks
+}
+
+// ParseKeyPEM reads an RSA or Ed25519 key. Private keys can sign; a bare
+// public key is accepted so that retired keys can be kept for verification
+// after the private half has been destroyed.
+func ParseKeyPEM(kid string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("key %s is not PEM encoded", kid)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		return checkRSAKey(NewRSAKey(kid, private))
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		switch private := parsed.(type) {
+		case *rsa.PrivateKey:
+			return checkRSAKey(NewRSAKey(kid, private))
+		case ed25519.PrivateKey:
+			return NewEd25519Key(kid, private), nil
+		}
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		switch public := parsed.(type) {
+		case *rsa.PublicKey:
+			return checkRSAKey(SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Public: public})
+		case ed25519.PublicKey:
+			return SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Public: public}, nil
+		}
+	}
+
+	return SigningKey{}, fmt.Errorf("key %s has an unsupported type", kid)
+}
+
+func checkRSAKey(key SigningKey) (SigningKey, error) {
+	if key.Public.(*rsa.PublicKey).N.BitLen() < 2048 {
+		return SigningKey{}, fmt.Errorf("RSA key %s is shorter than 2048 bits", key.ID)
+	}
+	return key, nil
+}
+
+// LoadKeySet reads every <kid>.pem file in dir and signs with activeKID. The
+// other keys only verify, and only for retireAfter from the time they were
+// retired, which should be at least the access token lifetime.
+//
+// A key counts as retired from the first time it is loaded without being
+// active. That time is kept in <kid>.retired so restarts don't extend it; if
+// dir is read-only the file can be written by hand, otherwise the key is
+// retired from when this process started.
+func LoadKeySet(dir, activeKID string, retireAfter time.Duration) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := NewKeySet()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseKeyPEM(kid, data)
+		if err != nil {
+			return nil, err
+		}
+
+		stamp := filepath.Join(dir, kid+".retired")
+		if kid == activeKID {
+			//A key brought back into use starts over when it is retired again
+			if _, err := os.Stat(stamp); err == nil {
+				err = os.Remove(stamp)
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			retiredAt, err := readRetiredAt(stamp)
+			if err != nil {
+				return nil, err
+			}
+			key.NotAfter = retiredAt.Add(retireAfter)
+		}
+
+		err = ks.Add(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = ks.SetActive(activeKID)
+	if err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func readRetiredAt(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		retiredAt, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid retirement time in %s: %w", path, err)
+		}
+		return retiredAt, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	os.WriteFile(path, []byte(now.Format(time.RFC3339)+"\n"), 0o600)
+	return now, nil
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  SigningKey
+	}{
+		{name: "RS256", key: NewRSAKey("rsa-1", rsaKey)},
+		{name: "EdDSA", key: NewEd25519Key("ed-1", edKey)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := NewKeySet()
+			if err := keys.Add(tt.key); err != nil {
+				t.Fatal(err)
+			}
+			if err := keys.SetActive(tt.key.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			userID := uuid.New()
+			token, err := MakeJWT(userID, uuid.New(), RoleUser, keys, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+
+			claims, err := ValidateJWT(token, keys)
+			if err != nil {
+				t.Fatalf("ValidateJWT() error = %v", err)
+			}
+			if claims.UserID != userID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", claims.UserID, userID)
+			}
+
+			jwks := keys.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != tt.key.ID || jwks.Keys[0].Algorithm != tt.name {
+				t.Errorf("JWKS() = %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	keys := NewKeySet()
+	keys.Add(NewEd25519Key("old", oldKey))
+	keys.SetActive("old")
+
+	oldToken, _ := MakeJWT(uuid.New(), uuid.New(), RoleUser, keys, time.Hour)
+
+	err := keys.Rotate(NewEd25519Key("new", newKey), time.Hour)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+
+	newToken, _ := MakeJWT(uuid.New(), uuid.New(), RoleUser, keys, time.Hour)
+
+	if _, err := ValidateJWT(oldToken, keys); err != nil {
+		t.Errorf("token signed by the retired key should still verify: %v", err)
+	}
+	if _, err := ValidateJWT(newToken, keys); err != nil {
+		t.Errorf("token signed by the new key should verify: %v", err)
+	}
+	if len(keys.JWKS().Keys) != 2 {
+		t.Errorf("JWKS() should publish both keys during the overlap")
+	}
+
+	//Once the retirement window has passed the old key is gone
+	keys.Rotate(NewEd25519Key("newer", oldKey), -time.Second)
+	if _, err := ValidateJWT(newToken, keys); err == nil {
+		t.Errorf("token signed by an expired key should not verify")
+	}
+}
+
+func TestUnknownKid(t *testing.T) {
+	token, _ := MakeJWT(uuid.New(), uuid.New(), RoleUser, newHMACKeySet(t, "secret"), time.Hour)
+
+	keys := NewKeySet()
+	keys.Add(NewHMACKey("other", []byte("secret")))
+	keys.SetActive("other")
+
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Errorf("ValidateJWT() should reject a token whose kid isn't in the key set")
+	}
+}
+
+func TestJWKSOmitsSymmetricKeys(t *testing.T) {
+	if jwks := newHMACKeySet(t, "secret").JWKS(); len(jwks.Keys) != 0 {
+		t.Errorf("JWKS() published a symmetric key: %+v", jwks)
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	os.WriteFile(filepath.Join(dir, "current.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ = x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	os.WriteFile(filepath.Join(dir, "retired.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+
+	keys, err := LoadKeySet(dir, "current", time.Hour)
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	if len(keys.JWKS().Keys) != 2 {
+		t.Errorf("JWKS() = %+v, want both keys", keys.JWKS())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "retired.retired")); err != nil {
+		t.Errorf("LoadKeySet() did not record when the key was retired: %v", err)
+	}
+
+	if _, err := LoadKeySet(dir, "retired", time.Hour); err == nil {
+		t.Errorf("LoadKeySet() should refuse to sign with a public-only key")
+	}
+}
+
+func TestLoadKeySetDropsExpiredKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	os.WriteFile(filepath.Join(dir, "current.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ = x509.MarshalPKCS8PrivateKey(oldKey)
+	os.WriteFile(filepath.Join(dir, "old.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	retiredAt := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	os.WriteFile(filepath.Join(dir, "old.retired"), []byte(retiredAt), 0o600)
+
+	oldKeys, err := LoadKeySet(dir, "old", time.Hour)
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	token, _ := MakeJWT(uuid.New(), uuid.New(), RoleUser, oldKeys, time.Hour)
+
+	//Making old active again cleared its retirement, so retire it by hand
+	os.WriteFile(filepath.Join(dir, "old.retired"), []byte(retiredAt), 0o600)
+
+	keys, err := LoadKeySet(dir, "current", time.Hour)
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	if jwks := keys.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "current" {
+		t.Errorf("JWKS() = %+v, want only the current key", jwks)
+	}
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Errorf("ValidateJWT() accepted a token signed with an expired key")
+	}
+}
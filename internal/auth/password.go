@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// Argon2Params tune argon2id. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id.
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+var (
+	argon2Mu     sync.RWMutex
+	argon2Params = DefaultArgon2Params
+)
+
+// SetArgon2Params changes the parameters used for new hashes. Existing hashes
+// made with other parameters still verify but are reported as needing a
+// rehash.
+func SetArgon2Params(params Argon2Params) {
+	argon2Mu.Lock()
+	defer argon2Mu.Unlock()
+	argon2Params = params
+}
+
+func currentArgon2Params() Argon2Params {
+	argon2Mu.RLock()
+	defer argon2Mu.RUnlock()
+	return argon2Params
+}
+
+// HashPassword hashes password with argon2id and encodes the result, along
+// with its parameters, in the PHC string format.
+func HashPassword(password string) (string, error) {
+	params := currentArgon2Params()
+
+	salt := make([]byte, params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPasswordHash verifies password against an argon2id or legacy bcrypt
+// hash. A nil error means the password is correct; needsRehash then reports
+// whether the hash should be replaced with one from HashPassword.
+func CheckPasswordHash(password, hash string) (needsRehash bool, err error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return checkArgon2Hash(password, hash)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrPasswordMismatch
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func checkArgon2Hash(password, hash string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return false, errors.New("malformed argon2id hash")
+	}
+	if version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	params := Argon2Params{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return false, errors.New("malformed argon2id hash")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errors.New("malformed argon2id hash")
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errors.New("malformed argon2id hash")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(want))
+
+	got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, ErrPasswordMismatch
+	}
+
+	return params != currentArgon2Params(), nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordFormat(t *testing.T) {
+	hash, err := HashPassword("correctPassword123!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("HashPassword() = %s, want an argon2id PHC string", hash)
+	}
+
+	needsRehash, err := CheckPasswordHash("correctPassword123!", hash)
+	if err != nil || needsRehash {
+		t.Errorf("CheckPasswordHash() = %v, %v, want false, nil", needsRehash, err)
+	}
+
+	_, err = CheckPasswordHash("wrongPassword", hash)
+	if !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("CheckPasswordHash() error = %v, want ErrPasswordMismatch", err)
+	}
+}
+
+func TestCheckPasswordHashNeedsRehash(t *testing.T) {
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("correctPassword123!"), 10)
+	current, _ := HashPassword("correctPassword123!")
+
+	SetArgon2Params(Argon2Params{Memory: 32 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	defer SetArgon2Params(DefaultArgon2Params)
+	weaker, _ := HashPassword("correctPassword123!")
+	SetArgon2Params(DefaultArgon2Params)
+
+	tests := []struct {
+		name            string
+		hash            string
+		wantNeedsRehash bool
+	}{
+		{name: "Legacy bcrypt hash", hash: string(legacy), wantNeedsRehash: true},
+		{name: "Outdated argon2id parameters", hash: weaker, wantNeedsRehash: true},
+		{name: "Current argon2id parameters", hash: current, wantNeedsRehash: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := CheckPasswordHash("correctPassword123!", tt.hash)
+			if err != nil {
+				t.Fatalf("CheckPasswordHash() error = %v", err)
+			}
+			if needsRehash != tt.wantNeedsRehash {
+				t.Errorf("CheckPasswordHash() needsRehash = %v, want %v", needsRehash, tt.wantNeedsRehash)
+			}
+		})
+	}
+
+	_, err := CheckPasswordHash("wrongPassword", string(legacy))
+	if !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("CheckPasswordHash() on bcrypt error = %v, want ErrPasswordMismatch", err)
+	}
+}
+
+func TestCheckPasswordHashMalformed(t *testing.T) {
+	for _, hash := range []string{"$argon2id$v=19$m=1,t=1$abc", "$argon2id$v=18$m=1,t=1,p=1$YWJj$YWJj", "$argon2id$v=19$m=1,t=1,p=1$!!$YWJj"} {
+		if _, err := CheckPasswordHash("password", hash); err == nil {
+			t.Errorf("CheckPasswordHash(%q) should fail", hash)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package auth
+
+import "slices"
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles are ordered from least to most privileged. Moderators can look up,
+// suspend and log out regular users; admins can do everything.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// HasRole reports whether the caller's role is at least min. Personal access
+// tokens never carry a role.
+func (c Claims) HasRole(min string) bool {
+	have := slices.Index(Roles, c.Role)
+	want := slices.Index(Roles, min)
+	return have >= 0 && want >= 0 && have >= want
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "testing"
+
+func TestClaimsHasRole(t *testing.T) {
+	tests := []struct {
+		role string
+		min  string
+		want bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, RoleModerator, false},
+		{"", RoleUser, false},
+		{"superuser", RoleUser, false},
+		{RoleAdmin, "superuser", false},
+	}
+
+	for _, tt := range tests {
+		got := Claims{Role: tt.role}.HasRole(tt.min)
+		if got != tt.want {
+			t.Errorf("Claims{Role: %q}.HasRole(%q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told
+// apart from JWTs, and spotted by secret scanners if they leak.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+const (
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeChirpsDelete = "chirps:delete"
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+)
+
+// Scopes lists every scope a personal access token can be granted.
+var Scopes = []string{ScopeChirpsWrite, ScopeChirpsDelete, ScopeProfileRead, ScopeProfileWrite}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+func MakePersonalAccessToken() string {
+	return PersonalAccessTokenPrefix + MakeRefreshToken()
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// PersonalAccessTokenClaims describes a request made with a personal access
+// token rather than a login session.
+func PersonalAccessTokenClaims(userID, tokenID uuid.UUID, scopes []string) Claims {
+	return Claims{UserID: userID, TokenID: tokenID, Scopes: scopes}
+}
+
+// IsPersonalAccessToken reports whether the request was made with a personal
+// access token.
+func (c Claims) IsPersonalAccessToken() bool {
+	return c.TokenID != uuid.Nil
+}
+
+// HasScope reports whether the caller may act within scope. Login sessions
+// have every scope; personal access tokens only the ones they were given.
+func (c Claims) HasScope(scope string) bool {
+	if !c.IsPersonalAccessToken() {
+		return true
+	}
+	return slices.Contains(c.Scopes, scope)
+}
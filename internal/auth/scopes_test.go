@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPersonalAccessToken(t *testing.T) {
+	token := MakePersonalAccessToken()
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("IsPersonalAccessToken(%q) = false, want true", token)
+	}
+	if token == MakePersonalAccessToken() {
+		t.Error("MakePersonalAccessToken() returned the same token twice")
+	}
+	if IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("IsPersonalAccessToken() = true for a JWT")
+	}
+}
+
+func TestClaimsHasScope(t *testing.T) {
+	session := Claims{UserID: uuid.New(), SessionID: uuid.New()}
+	if !session.HasScope(ScopeChirpsDelete) {
+		t.Error("session HasScope() = false, want true")
+	}
+
+	pat := PersonalAccessTokenClaims(uuid.New(), uuid.New(), []string{ScopeChirpsWrite})
+	if !pat.IsPersonalAccessToken() {
+		t.Error("IsPersonalAccessToken() = false, want true")
+	}
+	if !pat.HasScope(ScopeChirpsWrite) {
+		t.Error("HasScope(chirps:write) = false, want true")
+	}
+	if pat.HasScope(ScopeChirpsDelete) {
+		t.Error("HasScope(chirps:delete) = true, want false")
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	if !ValidScope("profile:read") {
+		t.Error("ValidScope(profile:read) = false, want true")
+	}
+	if ValidScope("admin") {
+		t.Error("ValidScope(admin) = true, want false")
+	}
+}
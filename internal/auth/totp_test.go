@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Shared secret from RFC 6238 appendix B ("12345678901234567890").
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := TOTPCode(rfcSecret, now)
+	previous, _ := TOTPCode(rfcSecret, now.Add(-30*time.Second))
+	stale, _ := TOTPCode(rfcSecret, now.Add(-90*time.Second))
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		wantOK bool
+	}{
+		{name: "Current code", secret: rfcSecret, code: code, wantOK: true},
+		{name: "Previous step within skew", secret: rfcSecret, code: previous, wantOK: true},
+		{name: "Stale code", secret: rfcSecret, code: stale, wantOK: false},
+		{name: "Wrong length", secret: rfcSecret, code: "12345", wantOK: false},
+		{name: "Invalid secret", secret: "not base32!", code: code, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK {
+				t.Errorf("ValidateTOTP() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step > now.Unix()/30 {
+				t.Errorf("ValidateTOTP() step = %d is in the future", step)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+
+	code, _ := TOTPCode(secret, time.Now())
+	if _, ok := ValidateTOTP(secret, code, time.Now()); !ok {
+		t.Errorf("a freshly generated secret should validate its own code")
+	}
+
+	uri := TOTPURI(secret, "Chirpy", "user@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("TOTPURI() = %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected recovery code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code %q", code)
+		}
+		seen[code] = true
+	}
+
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")) + " "
+	if NormalizeRecoveryCode(typed) != codes[0] {
+		t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", typed, NormalizeRecoveryCode(typed), codes[0])
+	}
+}
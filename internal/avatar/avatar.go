@@ -0,0 +1,80 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Sizes are the edge lengths, in pixels, of the square thumbnails made for
+// every avatar.
+var Sizes = []int{64, 128, 256}
+
+// MaxDimension bounds the width and height of an upload so a small file
+// cannot decode into an enormous bitmap.
+const MaxDimension = 4096
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+var formats = map[string]bool{"png": true, "jpeg": true, "webp": true}
+
+// Process decodes a PNG, JPEG or WebP image and returns a PNG thumbnail for
+// each of Sizes, keyed by size. The thumbnails are re-encoded from pixels, so
+// EXIF and any other metadata in the upload is dropped.
+func Process(r io.ReadSeeker) (map[int][]byte, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if !formats[format] {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, ErrTooLarge
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", format, err)
+	}
+
+	thumbnails := map[int][]byte{}
+	for _, size := range Sizes {
+		var buf bytes.Buffer
+		err = png.Encode(&buf, Thumbnail(img, size))
+		if err != nil {
+			return nil, err
+		}
+		thumbnails[size] = buf.Bytes()
+	}
+
+	return thumbnails, nil
+}
+
+// Thumbnail crops the centre square out of img and scales it to size by size.
+func Thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	edge := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-edge)/2
+	y := bounds.Min.Y + (bounds.Dy()-edge)/2
+	crop := image.Rect(x, y, x+edge, y+edge)
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, crop, draw.Src, nil)
+	return thumbnail
+}
@@ -0,0 +1,91 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessMakesSquareThumbnails(t *testing.T) {
+	//A wide image with a red centre and blue edges
+	src := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for x := 0; x < 300; x++ {
+		for y := 0; y < 100; y++ {
+			c := color.RGBA{B: 255, A: 255}
+			if x >= 100 && x < 200 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	thumbnails, err := Process(bytes.NewReader(encodePNG(t, src)))
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	for _, size := range Sizes {
+		img, err := png.Decode(bytes.NewReader(thumbnails[size]))
+		if err != nil {
+			t.Fatalf("size %d: png.Decode() error = %v", size, err)
+		}
+		if img.Bounds().Dx() != size || img.Bounds().Dy() != size {
+			t.Errorf("size %d: got %v", size, img.Bounds())
+		}
+		//Only the centre square is kept
+		r, _, b, _ := img.At(0, 0).RGBA()
+		if r < 0xf000 || b > 0x0fff {
+			t.Errorf("size %d: corner pixel is not red", size)
+		}
+	}
+}
+
+func TestProcessStripsMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10)), nil)
+	if err != nil {
+		t.Fatalf("jpeg.Encode() error = %v", err)
+	}
+
+	//Splice an APP1 EXIF segment in after the SOI marker
+	exif := append([]byte{0xff, 0xe1, 0x00, 0x12}, []byte("Exif\x00\x00GPS-SECRET")...)
+	upload := append(append([]byte{}, buf.Bytes()[:2]...), append(exif, buf.Bytes()[2:]...)...)
+
+	thumbnails, err := Process(bytes.NewReader(upload))
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	for size, data := range thumbnails {
+		if bytes.Contains(data, []byte("GPS-SECRET")) || bytes.Contains(data, []byte("Exif")) {
+			t.Errorf("size %d: thumbnail still carries EXIF data", size)
+		}
+	}
+}
+
+func TestProcessRejectsBadInput(t *testing.T) {
+	_, err := Process(strings.NewReader("GIF89a not really a picture"))
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Process() error = %v, want ErrUnsupportedFormat", err)
+	}
+
+	huge := encodePNG(t, image.NewGray(image.Rect(0, 0, MaxDimension+1, 1)))
+	_, err = Process(bytes.NewReader(huge))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Process() error = %v, want ErrTooLarge", err)
+	}
+}
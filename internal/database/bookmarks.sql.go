@@ -0,0 +1,94 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: bookmarks.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const createBookmark = `-- name: CreateBookmark :execrows
+INSERT INTO bookmarks (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING
+`
+
+type CreateBookmarkParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) CreateBookmark(ctx context.Context, arg CreateBookmarkParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createBookmark, arg.UserID, arg.ChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteBookmark = `-- name: DeleteBookmark :execrows
+DELETE FROM bookmarks
+WHERE user_id = $1 AND chirp_id = $2
+`
+
+type DeleteBookmarkParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) DeleteBookmark(ctx context.Context, arg DeleteBookmarkParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteBookmark, arg.UserID, arg.ChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getUserBookmarks = `-- name: GetUserBookmarks :many
+SELECT user_id, chirp_id, created_at FROM bookmarks
+WHERE user_id = $1
+AND ($2::TIMESTAMP IS NULL
+    OR (created_at, chirp_id) < ($2::TIMESTAMP, $3::UUID))
+ORDER BY created_at DESC, chirp_id DESC
+LIMIT $4
+`
+
+type GetUserBookmarksParams struct {
+	UserID          uuid.UUID
+	BeforeCreatedAt sql.NullTime
+	BeforeChirpID   uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) GetUserBookmarks(ctx context.Context, arg GetUserBookmarksParams) ([]Bookmark, error) {
+	rows, err := q.db.QueryContext(ctx, getUserBookmarks,
+		arg.UserID,
+		arg.BeforeCreatedAt,
+		arg.BeforeChirpID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Bookmark
+	for rows.Next() {
+		var i Bookmark
+		if err := rows.Scan(&i.UserID, &i.ChirpID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
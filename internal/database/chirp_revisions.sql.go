@@ -0,0 +1,70 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: chirp_revisions.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createChirpRevision = `-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, chirp_id, body, written_at, replaced_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+`
+
+type CreateChirpRevisionParams struct {
+	ChirpID   uuid.UUID
+	Body      string
+	WrittenAt time.Time
+}
+
+func (q *Queries) CreateChirpRevision(ctx context.Context, arg CreateChirpRevisionParams) error {
+	_, err := q.db.ExecContext(ctx, createChirpRevision, arg.ChirpID, arg.Body, arg.WrittenAt)
+	return err
+}
+
+const getChirpRevisions = `-- name: GetChirpRevisions :many
+SELECT id, chirp_id, body, written_at, replaced_at FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC
+`
+
+func (q *Queries) GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.Body,
+			&i.WrittenAt,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -7,29 +7,44 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, rechirp_of, is_quote)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $5::UUID,
+    $2,
+    $3,
+    $4
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	ParentID  uuid.NullUUID
+	RechirpOf uuid.NullUUID
+	IsQuote   bool
+	UserID    uuid.UUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.ParentID,
+		arg.RechirpOf,
+		arg.IsQuote,
+		arg.UserID,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,23 +52,37 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.RechirpOf,
+		&i.LikeCount,
+		&i.IsQuote,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
+const deletePlainRechirp = `-- name: DeletePlainRechirp :execrows
 DELETE FROM chirps
-WHERE chirps.id = $1
+WHERE user_id = $2::UUID AND rechirp_of = $1 AND NOT is_quote AND deleted_at IS NULL
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
-	return err
+type DeletePlainRechirpParams struct {
+	RechirpOf uuid.NullUUID
+	UserID    uuid.UUID
+}
+
+func (q *Queries) DeletePlainRechirp(ctx context.Context, arg DeletePlainRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePlainRechirp, arg.RechirpOf, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getAuthorChirps = `-- name: GetAuthorChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE chirps.user_id = $1
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM chirps
+WHERE chirps.user_id = $1::UUID AND chirps.deleted_at IS NULL
 ORDER BY created_at
 `
 
@@ -72,6 +101,59 @@ func (q *Queries) GetAuthorChirps(ctx context.Context, userID uuid.UUID) ([]Chir
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.DeletedAt,
+			&i.ParentID,
+			&i.RechirpOf,
+			&i.LikeCount,
+			&i.IsQuote,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAuthorChirpsWithTrash = `-- name: GetAuthorChirpsWithTrash :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM chirps
+WHERE chirps.user_id = $1::UUID
+AND (chirps.deleted_at IS NULL OR chirps.deleted_at > $2::TIMESTAMP)
+ORDER BY created_at
+`
+
+type GetAuthorChirpsWithTrashParams struct {
+	UserID       uuid.UUID
+	DeletedAfter time.Time
+}
+
+func (q *Queries) GetAuthorChirpsWithTrash(ctx context.Context, arg GetAuthorChirpsWithTrashParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAuthorChirpsWithTrash, arg.UserID, arg.DeletedAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.DeletedAt,
+			&i.ParentID,
+			&i.RechirpOf,
+			&i.LikeCount,
+			&i.IsQuote,
 		); err != nil {
 			return nil, err
 		}
@@ -87,8 +169,8 @@ func (q *Queries) GetAuthorChirps(ctx context.Context, userID uuid.UUID) ([]Chir
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE chirps.id = $1
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM chirps
+WHERE chirps.id = $1 AND chirps.deleted_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -100,17 +182,374 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.RechirpOf,
+		&i.LikeCount,
+		&i.IsQuote,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.search_vector, parent.deleted_at, parent.parent_id, parent.rechirp_of, parent.like_count, parent.is_quote, 1 AS depth FROM chirps AS parent
+    WHERE parent.id = (SELECT start.parent_id FROM chirps AS start WHERE start.id = $1)
+    UNION ALL
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.search_vector, parent.deleted_at, parent.parent_id, parent.rechirp_of, parent.like_count, parent.is_quote, ancestors.depth + 1 FROM chirps AS parent
+    JOIN ancestors ON parent.id = ancestors.parent_id
+    WHERE ancestors.depth < 100
+)
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM ancestors
+ORDER BY depth DESC
+`
+
+type GetChirpAncestorsRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.NullUUID
+	SearchVector interface{}
+	DeletedAt    sql.NullTime
+	ParentID     uuid.NullUUID
+	RechirpOf    uuid.NullUUID
+	LikeCount    int32
+	IsQuote      bool
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]GetChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAncestorsRow
+	for rows.Next() {
+		var i GetChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.DeletedAt,
+			&i.ParentID,
+			&i.RechirpOf,
+			&i.LikeCount,
+			&i.IsQuote,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT reply.id, reply.created_at, reply.updated_at, reply.body, reply.user_id, reply.search_vector, reply.deleted_at, reply.parent_id, reply.rechirp_of, reply.like_count, reply.is_quote, 1 AS depth,
+        ARRAY[to_char(reply.created_at, 'YYYYMMDDHH24MISSUS') || reply.id::TEXT] AS path
+    FROM chirps AS reply
+    WHERE reply.parent_id = $3::UUID
+    UNION ALL
+    SELECT reply.id, reply.created_at, reply.updated_at, reply.body, reply.user_id, reply.search_vector, reply.deleted_at, reply.parent_id, reply.rechirp_of, reply.like_count, reply.is_quote, descendants.depth + 1,
+        descendants.path || (to_char(reply.created_at, 'YYYYMMDDHH24MISSUS') || reply.id::TEXT)
+    FROM chirps AS reply
+    JOIN descendants ON reply.parent_id = descendants.id
+    WHERE descendants.depth < $4::INTEGER
+)
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote,
+    depth::INTEGER AS depth, path::TEXT[] AS path
+FROM descendants
+WHERE (deleted_at IS NULL OR EXISTS (SELECT 1 FROM chirps AS child WHERE child.parent_id = descendants.id))
+AND ($1::TEXT[] IS NULL OR path > $1::TEXT[])
+ORDER BY path
+LIMIT $2
+`
+
+type GetChirpDescendantsParams struct {
+	AfterPath []string
+	Limit     int32
+	RootID    uuid.UUID
+	MaxDepth  int32
+}
+
+type GetChirpDescendantsRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.NullUUID
+	SearchVector interface{}
+	DeletedAt    sql.NullTime
+	ParentID     uuid.NullUUID
+	RechirpOf    uuid.NullUUID
+	LikeCount    int32
+	IsQuote      bool
+	Depth        int32
+	Path         []string
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants,
+		pq.Array(arg.AfterPath),
+		arg.Limit,
+		arg.RootID,
+		arg.MaxDepth,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.DeletedAt,
+			&i.ParentID,
+			&i.RechirpOf,
+			&i.LikeCount,
+			&i.IsQuote,
+			&i.Depth,
+			pq.Array(&i.Path),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM chirps
+WHERE chirps.id = $1 AND chirps.deleted_at IS NULL
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.RechirpOf,
+		&i.LikeCount,
+		&i.IsQuote,
+	)
+	return i, err
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM chirps
+WHERE id = ANY($1::UUID[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.DeletedAt,
+			&i.ParentID,
+			&i.RechirpOf,
+			&i.LikeCount,
+			&i.IsQuote,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedChirps = `-- name: GetDeletedChirps :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM chirps
+WHERE user_id = $1::UUID AND deleted_at > $2::TIMESTAMP
+ORDER BY deleted_at DESC
+`
+
+type GetDeletedChirpsParams struct {
+	UserID       uuid.UUID
+	DeletedAfter time.Time
+}
+
+func (q *Queries) GetDeletedChirps(ctx context.Context, arg GetDeletedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getDeletedChirps, arg.UserID, arg.DeletedAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.DeletedAt,
+			&i.ParentID,
+			&i.RechirpOf,
+			&i.LikeCount,
+			&i.IsQuote,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRechirpCounts = `-- name: GetRechirpCounts :many
+SELECT rechirp_of,
+    COUNT(*) FILTER (WHERE NOT is_quote) AS rechirp_count,
+    COUNT(*) FILTER (WHERE is_quote) AS quote_count
+FROM chirps
+WHERE rechirp_of = ANY($1::UUID[]) AND deleted_at IS NULL
+GROUP BY rechirp_of
+`
+
+type GetRechirpCountsRow struct {
+	RechirpOf    uuid.NullUUID
+	RechirpCount int64
+	QuoteCount   int64
+}
+
+func (q *Queries) GetRechirpCounts(ctx context.Context, ids []uuid.UUID) ([]GetRechirpCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRechirpCounts, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRechirpCountsRow
+	for rows.Next() {
+		var i GetRechirpCountsRow
+		if err := rows.Scan(&i.RechirpOf, &i.RechirpCount, &i.QuoteCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReplyCounts = `-- name: GetReplyCounts :many
+SELECT parent_id, COUNT(*) AS reply_count FROM chirps
+WHERE parent_id = ANY($1::UUID[]) AND deleted_at IS NULL
+GROUP BY parent_id
+`
+
+type GetReplyCountsRow struct {
+	ParentID   uuid.NullUUID
+	ReplyCount int64
+}
+
+func (q *Queries) GetReplyCounts(ctx context.Context, ids []uuid.UUID) ([]GetReplyCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getReplyCounts, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReplyCountsRow
+	for rows.Next() {
+		var i GetReplyCountsRow
+		if err := rows.Scan(&i.ParentID, &i.ReplyCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM chirps
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR is_quote
+    OR EXISTS (SELECT 1 FROM chirps AS original WHERE original.id = chirps.rechirp_of AND original.deleted_at IS NULL))
+AND ($1::UUID IS NULL OR user_id = $1::UUID)
+AND ($2::TIMESTAMP IS NULL
+    OR (created_at, id) > ($2::TIMESTAMP, $3::UUID))
+ORDER BY created_at, id
+LIMIT $4
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListChirpsAscParams struct {
+	AuthorID       uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +563,12 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.DeletedAt,
+			&i.ParentID,
+			&i.RechirpOf,
+			&i.LikeCount,
+			&i.IsQuote,
 		); err != nil {
 			return nil, err
 		}
@@ -137,3 +582,318 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM chirps
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR is_quote
+    OR EXISTS (SELECT 1 FROM chirps AS original WHERE original.id = chirps.rechirp_of AND original.deleted_at IS NULL))
+AND ($1::UUID IS NULL OR user_id = $1::UUID)
+AND ($2::TIMESTAMP IS NULL
+    OR (created_at, id) < ($2::TIMESTAMP, $3::UUID))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID       uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.DeletedAt,
+			&i.ParentID,
+			&i.RechirpOf,
+			&i.LikeCount,
+			&i.IsQuote,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedChirpRevisions = `-- name: PurgeDeletedChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id IN (
+    SELECT id FROM chirps
+    WHERE deleted_at <= $1::TIMESTAMP
+)
+`
+
+func (q *Queries) PurgeDeletedChirpRevisions(ctx context.Context, deletedBefore time.Time) error {
+	_, err := q.db.ExecContext(ctx, purgeDeletedChirpRevisions, deletedBefore)
+	return err
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at <= $1::TIMESTAMP
+AND NOT EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.parent_id = chirps.id)
+AND NOT EXISTS (SELECT 1 FROM chirps AS quotes WHERE quotes.rechirp_of = chirps.id AND quotes.is_quote)
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const purgeOrphanedRechirps = `-- name: PurgeOrphanedRechirps :exec
+DELETE FROM chirps
+WHERE NOT is_quote AND rechirp_of IN (
+    SELECT id FROM chirps AS original
+    WHERE original.deleted_at <= $1::TIMESTAMP
+)
+`
+
+func (q *Queries) PurgeOrphanedRechirps(ctx context.Context, deletedBefore time.Time) error {
+	_, err := q.db.ExecContext(ctx, purgeOrphanedRechirps, deletedBefore)
+	return err
+}
+
+const purgeUserChirpRevisions = `-- name: PurgeUserChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id IN (
+    SELECT id FROM chirps
+    WHERE user_id = $1::UUID
+)
+`
+
+func (q *Queries) PurgeUserChirpRevisions(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, purgeUserChirpRevisions, userID)
+	return err
+}
+
+const purgeUserRechirps = `-- name: PurgeUserRechirps :exec
+DELETE FROM chirps
+WHERE NOT is_quote AND rechirp_of IN (
+    SELECT id FROM chirps AS original
+    WHERE original.user_id = $1::UUID
+)
+`
+
+func (q *Queries) PurgeUserRechirps(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, purgeUserRechirps, userID)
+	return err
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2::UUID AND deleted_at > $3::TIMESTAMP
+RETURNING id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote
+`
+
+type RestoreChirpParams struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	DeletedAfter time.Time
+}
+
+func (q *Queries) RestoreChirp(ctx context.Context, arg RestoreChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, arg.ID, arg.UserID, arg.DeletedAfter)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.RechirpOf,
+		&i.LikeCount,
+		&i.IsQuote,
+	)
+	return i, err
+}
+
+const scrubDeletedChirps = `-- name: ScrubDeletedChirps :execrows
+UPDATE chirps
+SET body = ''
+WHERE deleted_at <= $1::TIMESTAMP AND body <> ''
+`
+
+func (q *Queries) ScrubDeletedChirps(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, scrubDeletedChirps, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.deleted_at, chirps.parent_id, chirps.rechirp_of, chirps.like_count, chirps.is_quote,
+    ts_rank(chirps.search_vector, query)::REAL AS rank,
+    ts_headline('english', chirps.body, query, $1::TEXT)::TEXT AS snippet
+FROM chirps, to_tsquery('english', $2::TEXT) AS query
+WHERE chirps.search_vector @@ query
+AND chirps.deleted_at IS NULL
+AND ($3::UUID IS NULL OR chirps.user_id = $3::UUID)
+AND ($4::TIMESTAMP IS NULL OR chirps.created_at >= $4::TIMESTAMP)
+AND ($5::TIMESTAMP IS NULL OR chirps.created_at < $5::TIMESTAMP)
+AND ($6::REAL IS NULL
+    OR (ts_rank(chirps.search_vector, query), chirps.created_at, chirps.id)
+        < ($6::REAL, $7::TIMESTAMP, $8::UUID))
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT $9
+`
+
+type SearchChirpsParams struct {
+	HeadlineOptions string
+	Query           string
+	AuthorID        uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	AfterRank       sql.NullFloat64
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	Limit           int32
+}
+
+type SearchChirpsRow struct {
+	Chirp   Chirp
+	Rank    float32
+	Snippet string
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.HeadlineOptions,
+		arg.Query,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.AfterRank,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.ParentID,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.LikeCount,
+			&i.Chirp.IsQuote,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :execrows
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE chirps.id = $1 AND chirps.deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const tombstoneUserChirps = `-- name: TombstoneUserChirps :execrows
+UPDATE chirps
+SET body = '', user_id = NULL, deleted_at = COALESCE(deleted_at, NOW())
+WHERE user_id = $1::UUID
+AND (EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.parent_id = chirps.id)
+    OR EXISTS (SELECT 1 FROM chirps AS quotes WHERE quotes.rechirp_of = chirps.id AND quotes.is_quote))
+`
+
+func (q *Queries) TombstoneUserChirps(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, tombstoneUserChirps, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.RechirpOf,
+		&i.LikeCount,
+		&i.IsQuote,
+	)
+	return i, err
+}
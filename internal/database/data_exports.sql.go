@@ -0,0 +1,172 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: data_exports.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const completeDataExport = `-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', file_path = $2, expires_at = $3, updated_at = NOW()
+WHERE id = $1
+`
+
+type CompleteDataExportParams struct {
+	ID        uuid.UUID
+	FilePath  sql.NullString
+	ExpiresAt sql.NullTime
+}
+
+func (q *Queries) CompleteDataExport(ctx context.Context, arg CompleteDataExportParams) error {
+	_, err := q.db.ExecContext(ctx, completeDataExport, arg.ID, arg.FilePath, arg.ExpiresAt)
+	return err
+}
+
+const createDataExport = `-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id, status, file_path, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    'pending',
+    NULL,
+    NULL
+)
+RETURNING id, created_at, updated_at, user_id, status, file_path, expires_at
+`
+
+func (q *Queries) CreateDataExport(ctx context.Context, userID uuid.UUID) (DataExport, error) {
+	row := q.db.QueryRowContext(ctx, createDataExport, userID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.FilePath,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const deleteDataExport = `-- name: DeleteDataExport :exec
+DELETE FROM data_exports
+WHERE id = $1
+`
+
+func (q *Queries) DeleteDataExport(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteDataExport, id)
+	return err
+}
+
+const failDataExport = `-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', expires_at = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type FailDataExportParams struct {
+	ID        uuid.UUID
+	ExpiresAt sql.NullTime
+}
+
+func (q *Queries) FailDataExport(ctx context.Context, arg FailDataExportParams) error {
+	_, err := q.db.ExecContext(ctx, failDataExport, arg.ID, arg.ExpiresAt)
+	return err
+}
+
+const failStaleDataExports = `-- name: FailStaleDataExports :exec
+UPDATE data_exports
+SET status = 'failed', expires_at = NOW(), updated_at = NOW()
+WHERE status = 'pending' AND created_at <= $1
+`
+
+func (q *Queries) FailStaleDataExports(ctx context.Context, createdAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, failStaleDataExports, createdAt)
+	return err
+}
+
+const getDataExport = `-- name: GetDataExport :one
+SELECT id, created_at, updated_at, user_id, status, file_path, expires_at FROM data_exports
+WHERE id = $1
+`
+
+func (q *Queries) GetDataExport(ctx context.Context, id uuid.UUID) (DataExport, error) {
+	row := q.db.QueryRowContext(ctx, getDataExport, id)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.FilePath,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getExpiredDataExports = `-- name: GetExpiredDataExports :many
+SELECT id, created_at, updated_at, user_id, status, file_path, expires_at FROM data_exports
+WHERE expires_at IS NOT NULL AND expires_at <= NOW()
+`
+
+func (q *Queries) GetExpiredDataExports(ctx context.Context) ([]DataExport, error) {
+	rows, err := q.db.QueryContext(ctx, getExpiredDataExports)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DataExport
+	for rows.Next() {
+		var i DataExport
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Status,
+			&i.FilePath,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hasPendingDataExport = `-- name: HasPendingDataExport :one
+SELECT EXISTS (
+    SELECT 1 FROM data_exports
+    WHERE user_id = $1 AND status = 'pending' AND created_at > $2
+)
+`
+
+type HasPendingDataExportParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) HasPendingDataExport(ctx context.Context, arg HasPendingDataExportParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, hasPendingDataExport, arg.UserID, arg.CreatedAt)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
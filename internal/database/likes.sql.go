@@ -0,0 +1,196 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: likes.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const addToLikeCount = `-- name: AddToLikeCount :one
+UPDATE chirps
+SET like_count = like_count + $2::INTEGER
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote
+`
+
+type AddToLikeCountParams struct {
+	ID    uuid.UUID
+	Delta int32
+}
+
+func (q *Queries) AddToLikeCount(ctx context.Context, arg AddToLikeCountParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, addToLikeCount, arg.ID, arg.Delta)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.DeletedAt,
+		&i.ParentID,
+		&i.RechirpOf,
+		&i.LikeCount,
+		&i.IsQuote,
+	)
+	return i, err
+}
+
+const createLike = `-- name: CreateLike :execrows
+INSERT INTO likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING
+`
+
+type CreateLikeParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) CreateLike(ctx context.Context, arg CreateLikeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createLike, arg.UserID, arg.ChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteLike = `-- name: DeleteLike :execrows
+DELETE FROM likes
+WHERE user_id = $1 AND chirp_id = $2
+`
+
+type DeleteLikeParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) DeleteLike(ctx context.Context, arg DeleteLikeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteLike, arg.UserID, arg.ChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLikedChirpIDs = `-- name: GetLikedChirpIDs :many
+SELECT chirp_id FROM likes
+WHERE user_id = $1 AND chirp_id = ANY($2::UUID[])
+`
+
+type GetLikedChirpIDsParams struct {
+	UserID uuid.UUID
+	Ids    []uuid.UUID
+}
+
+func (q *Queries) GetLikedChirpIDs(ctx context.Context, arg GetLikedChirpIDsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getLikedChirpIDs, arg.UserID, pq.Array(arg.Ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var chirp_id uuid.UUID
+		if err := rows.Scan(&chirp_id); err != nil {
+			return nil, err
+		}
+		items = append(items, chirp_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserLikes = `-- name: GetUserLikes :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.deleted_at, chirps.parent_id, chirps.rechirp_of, chirps.like_count, chirps.is_quote, likes.created_at AS liked_at FROM likes
+JOIN chirps ON chirps.id = likes.chirp_id
+WHERE likes.user_id = $1
+AND chirps.deleted_at IS NULL
+AND ($2::TIMESTAMP IS NULL
+    OR (likes.created_at, likes.chirp_id) < ($2::TIMESTAMP, $3::UUID))
+ORDER BY likes.created_at DESC, likes.chirp_id DESC
+LIMIT $4
+`
+
+type GetUserLikesParams struct {
+	UserID        uuid.UUID
+	BeforeLikedAt sql.NullTime
+	BeforeChirpID uuid.NullUUID
+	Limit         int32
+}
+
+type GetUserLikesRow struct {
+	Chirp   Chirp
+	LikedAt time.Time
+}
+
+func (q *Queries) GetUserLikes(ctx context.Context, arg GetUserLikesParams) ([]GetUserLikesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserLikes,
+		arg.UserID,
+		arg.BeforeLikedAt,
+		arg.BeforeChirpID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserLikesRow
+	for rows.Next() {
+		var i GetUserLikesRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.ParentID,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.LikeCount,
+			&i.Chirp.IsQuote,
+			&i.LikedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeUserLikes = `-- name: PurgeUserLikes :exec
+WITH removed AS (
+    DELETE FROM likes
+    WHERE likes.user_id = $1
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET like_count = like_count - 1
+WHERE id IN (SELECT chirp_id FROM removed)
+`
+
+func (q *Queries) PurgeUserLikes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, purgeUserLikes, userID)
+	return err
+}
@@ -0,0 +1,80 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: login_attempts.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const clearLoginAttempts = `-- name: ClearLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE attempt_key = $1
+`
+
+func (q *Queries) ClearLoginAttempts(ctx context.Context, attemptKey string) error {
+	_, err := q.db.ExecContext(ctx, clearLoginAttempts, attemptKey)
+	return err
+}
+
+const getLoginLockout = `-- name: GetLoginLockout :one
+SELECT locked_until FROM login_attempts
+WHERE attempt_key = $1
+`
+
+func (q *Queries) GetLoginLockout(ctx context.Context, attemptKey string) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getLoginLockout, attemptKey)
+	var locked_until sql.NullTime
+	err := row.Scan(&locked_until)
+	return locked_until, err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (attempt_key, failures, last_failure_at, locked_until)
+VALUES (
+    $1,
+    1,
+    $2,
+    NULL
+)
+ON CONFLICT (attempt_key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure_at < $3::TIMESTAMP THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = EXCLUDED.last_failure_at
+RETURNING failures
+`
+
+type RecordLoginFailureParams struct {
+	AttemptKey    string
+	LastFailureAt time.Time
+	WindowStart   time.Time
+}
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordLoginFailure, arg.AttemptKey, arg.LastFailureAt, arg.WindowStart)
+	var failures int32
+	err := row.Scan(&failures)
+	return failures, err
+}
+
+const setLoginLockout = `-- name: SetLoginLockout :exec
+UPDATE login_attempts
+SET locked_until = $2
+WHERE attempt_key = $1
+`
+
+type SetLoginLockoutParams struct {
+	AttemptKey  string
+	LockedUntil sql.NullTime
+}
+
+func (q *Queries) SetLoginLockout(ctx context.Context, arg SetLoginLockoutParams) error {
+	_, err := q.db.ExecContext(ctx, setLoginLockout, arg.AttemptKey, arg.LockedUntil)
+	return err
+}
@@ -0,0 +1,191 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: mfa.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createMFAChallenge = `-- name: CreateMFAChallenge :exec
+INSERT INTO mfa_challenges (token_hash, created_at, user_id, expires_at, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    NULL
+)
+`
+
+type CreateMFAChallengeParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateMFAChallenge(ctx context.Context, arg CreateMFAChallengeParams) error {
+	_, err := q.db.ExecContext(ctx, createMFAChallenge, arg.TokenHash, arg.UserID, arg.ExpiresAt)
+	return err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (code_hash, created_at, user_id, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    NULL
+)
+`
+
+type CreateRecoveryCodeParams struct {
+	CodeHash string
+	UserID   uuid.UUID
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createRecoveryCode, arg.CodeHash, arg.UserID)
+	return err
+}
+
+const deleteUserRecoveryCodes = `-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUserRecoveryCodes, userID)
+	return err
+}
+
+const disableUserTOTP = `-- name: DisableUserTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) DisableUserTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableUserTOTP, id)
+	return err
+}
+
+const enableUserTOTP = `-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled = TRUE, totp_last_step = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type EnableUserTOTPParams struct {
+	ID           uuid.UUID
+	TotpLastStep int64
+}
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, enableUserTOTP, arg.ID, arg.TotpLastStep)
+	return err
+}
+
+const getMFAChallenge = `-- name: GetMFAChallenge :one
+SELECT token_hash, created_at, user_id, expires_at, used_at, failed_attempts FROM mfa_challenges
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND failed_attempts < 5
+`
+
+func (q *Queries) GetMFAChallenge(ctx context.Context, tokenHash string) (MfaChallenge, error) {
+	row := q.db.QueryRowContext(ctx, getMFAChallenge, tokenHash)
+	var i MfaChallenge
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.FailedAttempts,
+	)
+	return i, err
+}
+
+const recordMFAChallengeFailure = `-- name: RecordMFAChallengeFailure :exec
+UPDATE mfa_challenges
+SET failed_attempts = failed_attempts + 1
+WHERE token_hash = $1
+`
+
+func (q *Queries) RecordMFAChallengeFailure(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, recordMFAChallengeFailure, tokenHash)
+	return err
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET totp_secret = $2, totp_enabled = FALSE, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetUserTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setUserTOTPSecret, arg.ID, arg.TotpSecret)
+	return err
+}
+
+const useMFAChallenge = `-- name: UseMFAChallenge :execrows
+UPDATE mfa_challenges
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL
+`
+
+func (q *Queries) UseMFAChallenge(ctx context.Context, tokenHash string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useMFAChallenge, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL
+`
+
+type UseRecoveryCodeParams struct {
+	CodeHash string
+	UserID   uuid.UUID
+}
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useRecoveryCode, arg.CodeHash, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2
+`
+
+type UseTOTPStepParams struct {
+	ID           uuid.UUID
+	TotpLastStep int64
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -11,28 +11,134 @@ import (
 	"github.com/google/uuid"
 )
 
+type Bookmark struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.NullUUID
+	SearchVector interface{}
+	DeletedAt    sql.NullTime
+	ParentID     uuid.NullUUID
+	RechirpOf    uuid.NullUUID
+	LikeCount    int32
+	IsQuote      bool
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	WrittenAt  time.Time
+	ReplacedAt time.Time
+}
+
+type DataExport struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Body      string
 	UserID    uuid.UUID
+	Status    string
+	FilePath  sql.NullString
+	ExpiresAt sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type LoginAttempt struct {
+	AttemptKey    string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type MfaChallenge struct {
+	TokenHash      string
+	CreatedAt      time.Time
+	UserID         uuid.UUID
+	ExpiresAt      time.Time
+	UsedAt         sql.NullTime
+	FailedAttempts int32
+}
+
+type MfaRecoveryCode struct {
+	CodeHash  string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	UsedAt    sql.NullTime
+}
+
+type PasswordResetToken struct {
+	TokenHash string
 	CreatedAt time.Time
-	UpdatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+	LastUsedAt time.Time
+	UserAgent  string
+	IpAddress  string
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	EmailVerified       bool
+	TotpSecret          sql.NullString
+	TotpEnabled         bool
+	TotpLastStep        int64
+	DeletionScheduledAt sql.NullTime
+	Handle              sql.NullString
+	DisplayName         string
+	Bio                 string
+	AvatarUrl           string
+	Role                string
+	SuspendedUntil      sql.NullTime
+	BannedAt            sql.NullTime
+	ModerationReason    string
+}
+
+type VerificationToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
 }
@@ -0,0 +1,171 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: personal_access_tokens.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createPersonalAccessToken = `-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, created_at, updated_at, user_id, name, token_hash, scopes, last_used_at, expires_at, revoked_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NULL,
+    $5,
+    NULL
+)
+RETURNING id, created_at, updated_at, user_id, name, token_hash, scopes, last_used_at, expires_at, revoked_at
+`
+
+type CreatePersonalAccessTokenParams struct {
+	UserID    uuid.UUID
+	Name      string
+	TokenHash string
+	Scopes    []string
+	ExpiresAt sql.NullTime
+}
+
+func (q *Queries) CreatePersonalAccessToken(ctx context.Context, arg CreatePersonalAccessTokenParams) (PersonalAccessToken, error) {
+	row := q.db.QueryRowContext(ctx, createPersonalAccessToken,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		pq.Array(arg.Scopes),
+		arg.ExpiresAt,
+	)
+	var i PersonalAccessToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		pq.Array(&i.Scopes),
+		&i.LastUsedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getActivePersonalAccessToken = `-- name: GetActivePersonalAccessToken :one
+SELECT id, created_at, updated_at, user_id, name, token_hash, scopes, last_used_at, expires_at, revoked_at FROM personal_access_tokens
+WHERE token_hash = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW())
+`
+
+func (q *Queries) GetActivePersonalAccessToken(ctx context.Context, tokenHash string) (PersonalAccessToken, error) {
+	row := q.db.QueryRowContext(ctx, getActivePersonalAccessToken, tokenHash)
+	var i PersonalAccessToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		pq.Array(&i.Scopes),
+		&i.LastUsedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getUserPersonalAccessTokens = `-- name: GetUserPersonalAccessTokens :many
+SELECT id, created_at, updated_at, user_id, name, token_hash, scopes, last_used_at, expires_at, revoked_at FROM personal_access_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetUserPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]PersonalAccessToken, error) {
+	rows, err := q.db.QueryContext(ctx, getUserPersonalAccessTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PersonalAccessToken
+	for rows.Next() {
+		var i PersonalAccessToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.TokenHash,
+			pq.Array(&i.Scopes),
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokePersonalAccessToken = `-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokePersonalAccessTokenParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) RevokePersonalAccessToken(ctx context.Context, arg RevokePersonalAccessTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokePersonalAccessToken, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserPersonalAccessTokens = `-- name: RevokeUserPersonalAccessTokens :exec
+UPDATE personal_access_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserPersonalAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserPersonalAccessTokens, userID)
+	return err
+}
+
+const touchPersonalAccessToken = `-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchPersonalAccessToken, id)
+	return err
+}
@@ -7,29 +7,102 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const banUser = `-- name: BanUser :one
+UPDATE users
+SET banned_at = NOW(), moderation_reason = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason
+`
+
+type BanUserParams struct {
+	ID               uuid.UUID
+	ModerationReason string
+}
+
+func (q *Queries) BanUser(ctx context.Context, arg BanUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, banUser, arg.ID, arg.ModerationReason)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
+	)
+	return i, err
+}
+
+const bootstrapAdmin = `-- name: BootstrapAdmin :execrows
+UPDATE users
+SET role = 'admin', updated_at = NOW()
+WHERE LOWER(email) = LOWER($1)
+AND email_verified = TRUE
+AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin')
+`
+
+func (q *Queries) BootstrapAdmin(ctx context.Context, email string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, bootstrapAdmin, email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -38,6 +111,19 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
 	)
 	return i, err
 }
@@ -52,7 +138,7 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red from users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason from users
 WHERE users.email = $1
 `
 
@@ -66,25 +152,237 @@ func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason FROM users
+WHERE LOWER(handle) = LOWER($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, lower string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, lower)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason from users
+WHERE users.id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
+	)
+	return i, err
+}
+
+const getUserHandles = `-- name: GetUserHandles :many
+SELECT id, handle FROM users
+WHERE id = ANY($1::UUID[]) AND handle IS NOT NULL
+`
+
+type GetUserHandlesRow struct {
+	ID     uuid.UUID
+	Handle sql.NullString
+}
+
+func (q *Queries) GetUserHandles(ctx context.Context, ids []uuid.UUID) ([]GetUserHandlesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserHandles, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserHandlesRow
+	for rows.Next() {
+		var i GetUserHandlesRow
+		if err := rows.Scan(&i.ID, &i.Handle); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersDueForPurge = `-- name: GetUsersDueForPurge :many
+SELECT id FROM users
+WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= NOW()
+`
+
+func (q *Queries) GetUsersDueForPurge(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersDueForPurge)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const patchUser = `-- name: PatchUser :one
 UPDATE users
-SET email = $2, hashed_password = $3
-WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SET email = COALESCE($1, email),
+    hashed_password = COALESCE($2, hashed_password),
+    handle = COALESCE($3, handle),
+    display_name = COALESCE($4, display_name),
+    bio = COALESCE($5, bio),
+    avatar_url = COALESCE($6, avatar_url),
+    email_verified = CASE
+        WHEN $1::TEXT IS NOT NULL AND $1::TEXT <> email THEN FALSE
+        ELSE email_verified
+    END,
+    updated_at = NOW()
+WHERE id = $7
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason
 `
 
-type UpdateUserParams struct {
+type PatchUserParams struct {
+	Email          sql.NullString
+	HashedPassword sql.NullString
+	Handle         sql.NullString
+	DisplayName    sql.NullString
+	Bio            sql.NullString
+	AvatarUrl      sql.NullString
 	ID             uuid.UUID
-	Email          string
-	HashedPassword string
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
+func (q *Queries) PatchUser(ctx context.Context, arg PatchUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, patchUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
+	)
+	return i, err
+}
+
+const purgeDeletedUser = `-- name: PurgeDeletedUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= NOW()
+`
+
+func (q *Queries) PurgeDeletedUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  uuid.UUID
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -93,10 +391,210 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
 	)
 	return i, err
 }
 
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason FROM users
+WHERE $3::TEXT = ''
+OR email ILIKE '%' || $3::TEXT || '%'
+OR handle ILIKE '%' || $3::TEXT || '%'
+ORDER BY created_at DESC
+LIMIT $1 OFFSET $2
+`
+
+type SearchUsersParams struct {
+	Limit  int32
+	Offset int32
+	Query  string
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Limit, arg.Offset, arg.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.EmailVerified,
+			&i.TotpSecret,
+			&i.TotpEnabled,
+			&i.TotpLastStep,
+			&i.DeletionScheduledAt,
+			&i.Handle,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarUrl,
+			&i.Role,
+			&i.SuspendedUntil,
+			&i.BannedAt,
+			&i.ModerationReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
+	)
+	return i, err
+}
+
+const suspendUser = `-- name: SuspendUser :one
+UPDATE users
+SET suspended_until = $2, moderation_reason = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason
+`
+
+type SuspendUserParams struct {
+	ID               uuid.UUID
+	SuspendedUntil   sql.NullTime
+	ModerationReason string
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, suspendUser, arg.ID, arg.SuspendedUntil, arg.ModerationReason)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
+	)
+	return i, err
+}
+
+const unbanUser = `-- name: UnbanUser :one
+UPDATE users
+SET suspended_until = NULL, banned_at = NULL, moderation_reason = '', updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason
+`
+
+func (q *Queries) UnbanUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, unbanUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
 const upgradeUser = `-- name: UpgradeUser :exec
 UPDATE users
 SET is_chirpy_red = TRUE
@@ -107,3 +605,37 @@ func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, upgradeUser, id)
 	return err
 }
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified = TRUE, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, totp_secret, totp_enabled, totp_last_step, deletion_scheduled_at, handle, display_name, bio, avatar_url, role, suspended_until, banned_at, moderation_reason
+`
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.ModerationReason,
+	)
+	return i, err
+}
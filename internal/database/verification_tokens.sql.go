@@ -0,0 +1,60 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: verification_tokens.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createVerificationToken = `-- name: CreateVerificationToken :exec
+INSERT INTO verification_tokens (token_hash, created_at, user_id, expires_at, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    NULL
+)
+`
+
+type CreateVerificationTokenParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateVerificationToken(ctx context.Context, arg CreateVerificationTokenParams) error {
+	_, err := q.db.ExecContext(ctx, createVerificationToken, arg.TokenHash, arg.UserID, arg.ExpiresAt)
+	return err
+}
+
+const expireUserVerificationTokens = `-- name: ExpireUserVerificationTokens :exec
+UPDATE verification_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) ExpireUserVerificationTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, expireUserVerificationTokens, userID)
+	return err
+}
+
+const useVerificationToken = `-- name: UseVerificationToken :one
+UPDATE verification_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id
+`
+
+func (q *Queries) UseVerificationToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, useVerificationToken, tokenHash)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
@@ -0,0 +1,196 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jja42/chirpy/internal/database"
+)
+
+// Store keeps failure counters and lockouts by key, for example
+// "email:someone@example.com" or "ip:203.0.113.7".
+type Store interface {
+	// RecordFailure counts a failed attempt at now and returns the number of
+	// failures for key. Failures are forgotten after window without a new one.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	SetLockedUntil(ctx context.Context, key string, until time.Time) error
+	// LockedUntil returns the zero time when key isn't locked.
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	Clear(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	// Failures allowed before the first lockout.
+	Threshold int
+	// Length of the first lockout. Every further failure doubles it.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Quiet period after which the failure count starts over.
+	Window time.Duration
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// delay is the lockout earned by the given number of failures.
+func (l *Limiter) delay(failures int) time.Duration {
+	if failures < l.policy.Threshold {
+		return 0
+	}
+	delay := l.policy.BaseDelay
+	for i := l.policy.Threshold; i < failures && delay < l.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.policy.MaxDelay {
+		delay = l.policy.MaxDelay
+	}
+	return delay
+}
+
+// Check returns how long the caller has to wait before key may try again.
+// Zero means the attempt is allowed.
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+	until, err := l.store.LockedUntil(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	wait := until.Sub(l.now())
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt for key and returns the lockout it caused,
+// if any.
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	now := l.now()
+	failures, err := l.store.RecordFailure(ctx, key, now, l.policy.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := l.delay(failures)
+	if delay == 0 {
+		return 0, nil
+	}
+	return delay, l.store.SetLockedUntil(ctx, key, now.Add(delay))
+}
+
+// Reset forgets every failure and lockout for key.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Clear(ctx, key)
+}
+
+type memoryEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// MemoryStore keeps counters in process memory. Each instance of the server
+// counts separately, so use PostgresStore when running more than one.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}}
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	if entry.lastFailure.Before(now.Add(-window)) {
+		entry.failures = 0
+	}
+	entry.failures++
+	entry.lastFailure = now
+	return entry.failures, nil
+}
+
+func (s *MemoryStore) SetLockedUntil(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	entry.lockedUntil = until
+	return nil
+}
+
+func (s *MemoryStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return time.Time{}, nil
+	}
+	return entry.lockedUntil, nil
+}
+
+func (s *MemoryStore) Clear(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// PostgresStore keeps counters in the login_attempts table so that every
+// instance of the server sees the same lockouts.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	failures, err := s.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		AttemptKey: key, LastFailureAt: now, WindowStart: now.Add(-window),
+	})
+	return int(failures), err
+}
+
+func (s *PostgresStore) SetLockedUntil(ctx context.Context, key string, until time.Time) error {
+	return s.db.SetLoginLockout(ctx, database.SetLoginLockoutParams{
+		AttemptKey: key, LockedUntil: sql.NullTime{Time: until, Valid: true},
+	})
+}
+
+func (s *PostgresStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	locked_until, err := s.db.GetLoginLockout(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return locked_until.Time, nil
+}
+
+func (s *PostgresStore) Clear(ctx context.Context, key string) error {
+	return s.db.ClearLoginAttempts(ctx, key)
+}
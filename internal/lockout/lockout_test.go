@@ -0,0 +1,96 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(NewMemoryStore(), Policy{
+		Threshold: 3,
+		BaseDelay: time.Minute,
+		MaxDelay:  10 * time.Minute,
+		Window:    time.Hour,
+	})
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter()
+
+	want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for i, expected := range want {
+		got, err := limiter.Fail(ctx, "email:user@example.com")
+		if err != nil {
+			t.Fatalf("Fail() error = %v", err)
+		}
+		if got != expected {
+			t.Errorf("failure %d: Fail() = %v, want %v", i+1, got, expected)
+		}
+	}
+
+	wait, _ := limiter.Check(ctx, "email:user@example.com")
+	if wait != 10*time.Minute {
+		t.Errorf("Check() = %v, want %v", wait, 10*time.Minute)
+	}
+
+	if wait, _ := limiter.Check(ctx, "email:other@example.com"); wait != 0 {
+		t.Errorf("Check() for an unrelated key = %v, want 0", wait)
+	}
+}
+
+func TestLimiterLockoutExpires(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+
+	for i := 0; i < 3; i++ {
+		limiter.Fail(ctx, "ip:203.0.113.7")
+	}
+	if wait, _ := limiter.Check(ctx, "ip:203.0.113.7"); wait != time.Minute {
+		t.Errorf("Check() = %v, want %v", wait, time.Minute)
+	}
+
+	*now = now.Add(time.Minute + time.Second)
+	if wait, _ := limiter.Check(ctx, "ip:203.0.113.7"); wait != 0 {
+		t.Errorf("Check() after the lockout = %v, want 0", wait)
+	}
+}
+
+func TestLimiterWindow(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+
+	limiter.Fail(ctx, "email:user@example.com")
+	limiter.Fail(ctx, "email:user@example.com")
+
+	//A long pause starts the count over
+	*now = now.Add(2 * time.Hour)
+	if got, _ := limiter.Fail(ctx, "email:user@example.com"); got != 0 {
+		t.Errorf("Fail() after the window = %v, want 0", got)
+	}
+}
+
+func TestLimiterReset(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter()
+
+	for i := 0; i < 5; i++ {
+		limiter.Fail(ctx, "email:user@example.com")
+	}
+
+	err := limiter.Reset(ctx, "email:user@example.com")
+	if err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+
+	if wait, _ := limiter.Check(ctx, "email:user@example.com"); wait != 0 {
+		t.Errorf("Check() after Reset() = %v, want 0", wait)
+	}
+	if got, _ := limiter.Fail(ctx, "email:user@example.com"); got != 0 {
+		t.Errorf("Fail() after Reset() = %v, want 0", got)
+	}
+}
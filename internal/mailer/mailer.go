@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email such as verification links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// MemoryMailer keeps every message in memory. It is meant for tests and
+// local development where nothing should leave the process.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := make([]Message, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
+
+// FileMailer writes each message to its own .eml file in a directory so it
+// can be opened with a mail client during local development.
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), sanitizeAddress(msg.To))
+	contents := fmt.Sprintf("Date: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		now.Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(contents), 0o644)
+}
+
+func sanitizeAddress(address string) string {
+	safe := []rune{}
+	for _, r := range address {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			safe = append(safe, r)
+		case r == '@':
+			safe = append(safe, '_')
+		}
+	}
+	return string(safe)
+}
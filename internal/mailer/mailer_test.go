@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	msg := Message{To: "user@example.com", Subject: "Hello", Body: "World"}
+
+	err := m.Send(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	messages := m.Messages()
+	if len(messages) != 1 || messages[0] != msg {
+		t.Errorf("Messages() = %v, want [%v]", messages, msg)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(dir)
+	if err != nil {
+		t.Fatalf("NewFileMailer() error = %v", err)
+	}
+
+	err = m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "World"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one message file, got %d (err = %v)", len(entries), err)
+	}
+	if !strings.HasSuffix(entries[0].Name(), "-user_example.com.eml") {
+		t.Errorf("unexpected file name %q", entries[0].Name())
+	}
+
+	contents, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	if !strings.Contains(string(contents), "Subject: Hello") || !strings.Contains(string(contents), "World") {
+		t.Errorf("message file missing subject or body: %q", contents)
+	}
+}
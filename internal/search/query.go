@@ -0,0 +1,130 @@
+package search
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptyQuery = errors.New("search query has no terms")
+
+// HeadlineOptions configure ts_headline so that matches are wrapped in
+// <mark> tags. Pass the result through Highlight before returning it.
+const HeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=20, MinWords=5, MaxFragments=2, FragmentDelimiter=\" … \""
+
+type term struct {
+	words  []string
+	prefix bool
+	negate bool
+	or     bool
+}
+
+// ParseQuery turns what a user typed into a search box into to_tsquery
+// syntax. Words must all match; "quoted phrases" match words in order, a
+// trailing * matches prefixes, a leading - excludes a word and OR between
+// two terms matches either. Everything but letters and digits is dropped, so
+// the result is always a valid tsquery.
+func ParseQuery(q string) (string, error) {
+	terms := []term{}
+	next_or := false
+
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		t := term{or: next_or}
+		next_or = false
+
+		if runes[i] == '-' {
+			t.negate = true
+			i++
+		}
+
+		var raw string
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			raw = string(runes[i+1 : end])
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			raw = string(runes[i:end])
+			i = end
+
+			if raw == "OR" && !t.negate {
+				next_or = len(terms) > 0
+				continue
+			}
+		}
+
+		t.prefix = strings.HasSuffix(raw, "*")
+		t.words = splitWords(raw)
+		if len(t.words) > 0 {
+			terms = append(terms, t)
+		}
+	}
+
+	positive := false
+	for _, t := range terms {
+		if !t.negate {
+			positive = true
+		}
+	}
+	if !positive {
+		return "", ErrEmptyQuery
+	}
+
+	var b strings.Builder
+	for i, t := range terms {
+		if i > 0 {
+			if t.or {
+				b.WriteString(" | ")
+			} else {
+				b.WriteString(" & ")
+			}
+		}
+		b.WriteString(t.String())
+	}
+
+	return b.String(), nil
+}
+
+func (t term) String() string {
+	words := make([]string, len(t.words))
+	copy(words, t.words)
+	if t.prefix {
+		words[len(words)-1] += ":*"
+	}
+
+	s := strings.Join(words, " <-> ")
+	if len(words) > 1 {
+		s = "(" + s + ")"
+	}
+	if t.negate {
+		s = "!" + s
+	}
+	return s
+}
+
+func splitWords(raw string) []string {
+	return strings.FieldsFunc(strings.ToLower(raw), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Highlight escapes a ts_headline snippet for HTML while keeping the <mark>
+// tags added by HeadlineOptions.
+func Highlight(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, "&lt;mark&gt;", "<mark>")
+	return strings.ReplaceAll(escaped, "&lt;/mark&gt;", "</mark>")
+}
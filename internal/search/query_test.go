@@ -0,0 +1,57 @@
+package search
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"single word", "chirpy", "chirpy"},
+		{"all words", "hello world", "hello & world"},
+		{"case and punctuation", "Hello, World!", "hello & world"},
+		{"phrase", `"boot dev" rocks`, "(boot <-> dev) & rocks"},
+		{"prefix", "chirp*", "chirp:*"},
+		{"phrase prefix", `"boot de*"`, "(boot <-> de:*)"},
+		{"negation", "go -java", "go & !java"},
+		{"or", "go OR rust", "go | rust"},
+		{"lowercase or is a word", "go or rust", "go & or & rust"},
+		{"leading or is ignored", "OR go", "go"},
+		{"hyphenated word", "e-mail", "(e <-> mail)"},
+		{"injection attempt", "a' & !b:* | (c", "a & b:* & c"},
+		{"unterminated quote", `"boot dev`, "(boot <-> dev)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryEmpty(t *testing.T) {
+	for _, query := range []string{"", "   ", "!!! ???", "-java", `""`} {
+		_, err := ParseQuery(query)
+		if !errors.Is(err, ErrEmptyQuery) {
+			t.Errorf("ParseQuery(%q) error = %v, want ErrEmptyQuery", query, err)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := Highlight(`<script>x</script> <mark>chirp</mark> & more`)
+	want := `&lt;script&gt;x&lt;/script&gt; <mark>chirp</mark> &amp; more`
+	if got != want {
+		t.Errorf("Highlight() = %q, want %q", got, want)
+	}
+}
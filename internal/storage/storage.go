@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage keeps opaque blobs, such as processed avatars, under slash
+// separated keys.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalStorage keeps blobs as files below a directory. It also serves them
+// over HTTP, with the key as the path.
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalStorage{dir: dir}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "..") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first so readers never see a partial blob.
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, r)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(file.Name(), 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+// Delete removes key. Deleting a key that does not exist is not an error.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP serves single blobs. Directory listings are refused so keys
+// cannot be discovered by browsing.
+func (s *LocalStorage) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	if strings.HasSuffix(req.URL.Path, "/") {
+		http.NotFound(writer, req)
+		return
+	}
+	http.FileServer(http.Dir(s.dir)).ServeHTTP(writer, req)
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoragePutAndServe(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage() error = %v", err)
+	}
+
+	err = store.Put(ctx, "avatars/user/64.png", strings.NewReader("image bytes"))
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	store.ServeHTTP(recorder, httptest.NewRequest("GET", "/avatars/user/64.png", nil))
+	if recorder.Code != 200 {
+		t.Fatalf("ServeHTTP() status = %d, want 200", recorder.Code)
+	}
+	body, _ := io.ReadAll(recorder.Body)
+	if string(body) != "image bytes" {
+		t.Errorf("ServeHTTP() body = %q, want %q", body, "image bytes")
+	}
+
+	recorder = httptest.NewRecorder()
+	store.ServeHTTP(recorder, httptest.NewRequest("GET", "/avatars/user/", nil))
+	if recorder.Code != 404 {
+		t.Errorf("ServeHTTP() for a directory status = %d, want 404", recorder.Code)
+	}
+
+	err = store.Delete(ctx, "avatars/user/64.png")
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	recorder = httptest.NewRecorder()
+	store.ServeHTTP(recorder, httptest.NewRequest("GET", "/avatars/user/64.png", nil))
+	if recorder.Code != 404 {
+		t.Errorf("ServeHTTP() after Delete() status = %d, want 404", recorder.Code)
+	}
+
+	//Deleting twice is fine
+	err = store.Delete(ctx, "avatars/user/64.png")
+	if err != nil {
+		t.Errorf("second Delete() error = %v", err)
+	}
+}
+
+func TestLocalStorageRejectsBadKeys(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewLocalStorage(t.TempDir())
+
+	keys := []string{"", "/etc/passwd", "../escape", "a/../../escape", "a//b", "a/./b"}
+	for _, key := range keys {
+		err := store.Put(ctx, key, strings.NewReader("x"))
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPeriodically calls job every interval until ctx is cancelled. Failures
+// are logged and retried on the next tick.
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := job(ctx)
+		if err != nil {
+			log.Printf("Error running %s: %s", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,24 +1,46 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
 
+	"github.com/jja42/chirpy/internal/auth"
 	"github.com/jja42/chirpy/internal/database"
+	"github.com/jja42/chirpy/internal/lockout"
+	"github.com/jja42/chirpy/internal/mailer"
+	"github.com/jja42/chirpy/internal/storage"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	db_conn        *sql.DB
 	platform       string
-	jwt_secret     string
+	jwt_keys       *auth.KeySet
 	polka_key      string
+
+	bootstrap_admin_email string
+	mailer                mailer.Mailer
+
+	deletion_grace_period time.Duration
+	chirp_trash_window    time.Duration
+
+	export_dir         string
+	export_signing_key []byte
+
+	avatar_store storage.Storage
+
+	login_account_limiter *lockout.Limiter
+	login_ip_limiter      *lockout.Limiter
 }
 
 func main() {
@@ -32,37 +54,228 @@ func main() {
 	dbQueries := database.New(db)
 	var apiCfg apiConfig
 	apiCfg.db = dbQueries
+	apiCfg.db_conn = db
 
 	platform := os.Getenv("PLATFORM")
 	apiCfg.platform = platform
 
-	secret := os.Getenv("JWT_SECRET")
-	apiCfg.jwt_secret = secret
+	//Asymmetric keys let other services verify tokens through the JWKS
+	//endpoint. Without them, fall back to signing with the shared secret.
+	keysDir := os.Getenv("JWT_KEYS_DIR")
+	if keysDir != "" {
+		keys, err := auth.LoadKeySet(keysDir, os.Getenv("JWT_ACTIVE_KID"), accessTokenTTL)
+		if err != nil {
+			fmt.Printf("Error: %s", err)
+			return
+		}
+		apiCfg.jwt_keys = keys
+	} else {
+		secret := os.Getenv("JWT_SECRET")
+		apiCfg.jwt_keys = auth.NewKeySet()
+		apiCfg.jwt_keys.Add(auth.NewHMACKey("default", []byte(secret)))
+		apiCfg.jwt_keys.SetActive("default")
+	}
+
+	argon2Params, err := argon2ParamsFromEnv()
+	if err != nil {
+		fmt.Printf("Error: %s", err)
+		return
+	}
+	auth.SetArgon2Params(argon2Params)
+
+	apiCfg.deletion_grace_period = 30 * 24 * time.Hour
+	graceDays := os.Getenv("ACCOUNT_DELETION_GRACE_DAYS")
+	if graceDays != "" {
+		days, err := strconv.Atoi(graceDays)
+		if err != nil || days < 0 {
+			fmt.Printf("Error: invalid ACCOUNT_DELETION_GRACE_DAYS: %q", graceDays)
+			return
+		}
+		apiCfg.deletion_grace_period = time.Duration(days) * 24 * time.Hour
+	}
+
+	apiCfg.chirp_trash_window = 30 * 24 * time.Hour
+	trashDays := os.Getenv("CHIRP_TRASH_DAYS")
+	if trashDays != "" {
+		days, err := strconv.Atoi(trashDays)
+		if err != nil || days < 0 {
+			fmt.Printf("Error: invalid CHIRP_TRASH_DAYS: %q", trashDays)
+			return
+		}
+		apiCfg.chirp_trash_window = time.Duration(days) * 24 * time.Hour
+	}
+
+	apiCfg.export_dir = os.Getenv("EXPORT_DIR")
+	if apiCfg.export_dir == "" {
+		apiCfg.export_dir = "exports"
+	}
+	err = os.MkdirAll(apiCfg.export_dir, 0o700)
+	if err != nil {
+		fmt.Printf("Error: %s", err)
+		return
+	}
+
+	//Without a configured key, download links stop working on restart
+	apiCfg.export_signing_key = []byte(os.Getenv("EXPORT_SIGNING_KEY"))
+	if len(apiCfg.export_signing_key) == 0 {
+		apiCfg.export_signing_key = []byte(auth.MakeRefreshToken())
+	}
+
+	avatarDir := os.Getenv("AVATAR_DIR")
+	if avatarDir == "" {
+		avatarDir = "avatars"
+	}
+	avatarStore, err := storage.NewLocalStorage(avatarDir)
+	if err != nil {
+		fmt.Printf("Error: %s", err)
+		return
+	}
+	apiCfg.avatar_store = avatarStore
+
+	//Promotes an existing verified account when no admin exists yet
+	apiCfg.bootstrap_admin_email = os.Getenv("BOOTSTRAP_ADMIN_EMAIL")
+	apiCfg.bootstrapAdmin(context.Background())
 
 	polkaKey := os.Getenv("POLKA_KEY")
 	apiCfg.polka_key = polkaKey
 
+	//Write outgoing mail to disk when a directory is configured. Mail is only
+	//kept in memory for local development.
+	mailDir := os.Getenv("MAILER_DIR")
+	if mailDir != "" {
+		fileMailer, err := mailer.NewFileMailer(mailDir)
+		if err != nil {
+			fmt.Printf("Error: %s", err)
+			return
+		}
+		apiCfg.mailer = fileMailer
+	} else if platform == "dev" {
+		apiCfg.mailer = mailer.NewMemoryMailer()
+	} else {
+		//The memory mailer drops everything, so nobody could verify their email
+		fmt.Println("Error: MAILER_DIR must be set outside of dev")
+		return
+	}
+
+	//Login failures are shared through Postgres unless asked otherwise
+	var lockoutStore lockout.Store
+	if os.Getenv("LOGIN_LOCKOUT_STORE") == "memory" {
+		lockoutStore = lockout.NewMemoryStore()
+	} else {
+		lockoutStore = lockout.NewPostgresStore(dbQueries)
+	}
+	apiCfg.login_account_limiter = lockout.NewLimiter(lockoutStore, loginAccountPolicy)
+	apiCfg.login_ip_limiter = lockout.NewLimiter(lockoutStore, loginIPPolicy)
+
 	mux := http.NewServeMux()
 
 	mux.Handle("/app/", http.StripPrefix("/app", apiCfg.middlewareMetricsInc(http.FileServer(http.Dir(".")))))
+	mux.Handle("GET /avatars/", middlewareCacheForever(http.StripPrefix("/avatars", avatarStore)))
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
+	mux.Handle("GET /admin/metrics", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerMetrics))
+	mux.Handle("POST /admin/reset", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerReset))
+	mux.Handle("DELETE /admin/lockouts", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerClearLockout))
+	//Moderators can look users up, suspend them and end their sessions; the
+	//rest is for admins
+	mux.Handle("GET /admin/users", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerSearchUsers))
+	mux.Handle("GET /admin/users/{id}", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerAdminGetUser))
+	mux.Handle("PUT /admin/users/{id}/role", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerSetUserRole))
+	mux.Handle("POST /admin/users/{id}/suspend", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerSuspendUser))
+	mux.Handle("POST /admin/users/{id}/ban", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerBanUser))
+	mux.Handle("POST /admin/users/{id}/unban", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerUnbanUser))
+	mux.Handle("POST /admin/users/{id}/logout", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerForceLogout))
 
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.handlerSearchChirps)
+	mux.HandleFunc("GET /api/chirps/trash", apiCfg.handlerGetTrash)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.handlerUpdateChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.handlerGetChirpRevisions)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.handlerGetThread)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", apiCfg.handlerRechirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", apiCfg.handlerUndoRechirp)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.handlerLikeChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.handlerUnlikeChirp)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/bookmark", apiCfg.handlerBookmarkChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/bookmark", apiCfg.handlerRemoveBookmark)
+	mux.HandleFunc("GET /api/bookmarks", apiCfg.handlerGetBookmarks)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/restore", apiCfg.handlerRestoreChirp)
 
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.handlerLoginMFA)
+	//PUT is kept for older clients but goes through the same checks as PATCH
+	mux.HandleFunc("PUT /api/users", apiCfg.handlerPatchUser)
+	mux.HandleFunc("PATCH /api/users", apiCfg.handlerPatchUser)
+	mux.HandleFunc("GET /api/users/me", apiCfg.handlerGetCurrentUser)
+	mux.HandleFunc("GET /api/users/{handle}", apiCfg.handlerGetProfile)
+	mux.HandleFunc("GET /api/users/{id}/likes", apiCfg.handlerGetUserLikes)
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.handlerDeleteAccount)
+	mux.HandleFunc("PUT /api/users/me/avatar", apiCfg.handlerUploadAvatar)
+	mux.HandleFunc("DELETE /api/users/me/deletion", apiCfg.handlerCancelAccountDeletion)
+	mux.HandleFunc("POST /api/users/me/export", apiCfg.handlerRequestExport)
+	mux.HandleFunc("GET /api/users/me/export/{id}", apiCfg.handlerGetExport)
+	mux.HandleFunc("GET /api/exports/{id}/download", apiCfg.handlerDownloadExport)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerResendVerification)
+
+	mux.HandleFunc("POST /api/mfa/totp/enroll", apiCfg.handlerEnrollTOTP)
+	mux.HandleFunc("POST /api/mfa/totp/confirm", apiCfg.handlerConfirmTOTP)
+	mux.HandleFunc("DELETE /api/mfa/totp", apiCfg.handlerDisableTOTP)
+
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerResetPassword)
 
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
 
+	mux.HandleFunc("GET /api/sessions", apiCfg.handlerGetSessions)
+	mux.HandleFunc("DELETE /api/sessions", apiCfg.handlerRevokeOtherSessions)
+	mux.HandleFunc("DELETE /api/sessions/{id}", apiCfg.handlerRevokeSession)
+
+	mux.HandleFunc("POST /api/tokens", apiCfg.handlerCreateToken)
+	mux.HandleFunc("GET /api/tokens", apiCfg.handlerGetTokens)
+	mux.HandleFunc("DELETE /api/tokens/{id}", apiCfg.handlerRevokeToken)
+
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolka)
 
+	go runPeriodically(context.Background(), "account purge", time.Hour, apiCfg.purgeDeletedUsers)
+	go runPeriodically(context.Background(), "export cleanup", time.Hour, apiCfg.cleanupDataExports)
+	go runPeriodically(context.Background(), "chirp purge", time.Hour, apiCfg.purgeDeletedChirps)
+
 	server := http.Server{Addr: ":8080", Handler: mux}
 	server.ListenAndServe()
 }
+
+// argon2ParamsFromEnv starts from the defaults and overrides whichever of
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM are set.
+func argon2ParamsFromEnv() (auth.Argon2Params, error) {
+	params := auth.DefaultArgon2Params
+
+	settings := []struct {
+		name string
+		bits int
+		set  func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	}
+
+	for _, setting := range settings {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil || parsed == 0 {
+			return params, fmt.Errorf("invalid %s: %q", setting.name, value)
+		}
+		setting.set(parsed)
+	}
+
+	return params, nil
+}
@@ -0,0 +1,16 @@
+-- name: CreateBookmark :execrows
+INSERT INTO bookmarks (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: DeleteBookmark :execrows
+DELETE FROM bookmarks
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: GetUserBookmarks :many
+SELECT * FROM bookmarks
+WHERE user_id = $1
+AND (sqlc.narg('before_created_at')::TIMESTAMP IS NULL
+    OR (created_at, chirp_id) < (sqlc.narg('before_created_at')::TIMESTAMP, sqlc.narg('before_chirp_id')::UUID))
+ORDER BY created_at DESC, chirp_id DESC
+LIMIT sqlc.arg('limit');
@@ -1,27 +1,192 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, rechirp_of, is_quote)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    sqlc.arg('user_id')::UUID,
+    $2,
+    $3,
+    $4
 )
 RETURNING *;
 
--- name: GetChirps :many
+-- name: ListChirpsAsc :many
 SELECT * FROM chirps
-ORDER BY created_at;   
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR is_quote
+    OR EXISTS (SELECT 1 FROM chirps AS original WHERE original.id = chirps.rechirp_of AND original.deleted_at IS NULL))
+AND (sqlc.narg('author_id')::UUID IS NULL OR user_id = sqlc.narg('author_id')::UUID)
+AND (sqlc.narg('after_created_at')::TIMESTAMP IS NULL
+    OR (created_at, id) > (sqlc.narg('after_created_at')::TIMESTAMP, sqlc.narg('after_id')::UUID))
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR is_quote
+    OR EXISTS (SELECT 1 FROM chirps AS original WHERE original.id = chirps.rechirp_of AND original.deleted_at IS NULL))
+AND (sqlc.narg('author_id')::UUID IS NULL OR user_id = sqlc.narg('author_id')::UUID)
+AND (sqlc.narg('after_created_at')::TIMESTAMP IS NULL
+    OR (created_at, id) < (sqlc.narg('after_created_at')::TIMESTAMP, sqlc.narg('after_id')::UUID))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: GetChirp :one
 SELECT * FROM chirps
-WHERE chirps.id = $1; 
+WHERE chirps.id = $1 AND chirps.deleted_at IS NULL;
 
--- name: DeleteChirp :exec
+-- name: SoftDeleteChirp :execrows
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE chirps.id = $1 AND chirps.deleted_at IS NULL;
+
+-- name: GetDeletedChirps :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg('user_id')::UUID AND deleted_at > sqlc.arg('deleted_after')::TIMESTAMP
+ORDER BY deleted_at DESC;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL
+WHERE id = $1 AND user_id = sqlc.arg('user_id')::UUID AND deleted_at > sqlc.arg('deleted_after')::TIMESTAMP
+RETURNING *;
+
+-- name: PurgeOrphanedRechirps :exec
 DELETE FROM chirps
-WHERE chirps.id = $1;
+WHERE NOT is_quote AND rechirp_of IN (
+    SELECT id FROM chirps AS original
+    WHERE original.deleted_at <= sqlc.arg('deleted_before')::TIMESTAMP
+);
+
+-- name: PurgeUserRechirps :exec
+DELETE FROM chirps
+WHERE NOT is_quote AND rechirp_of IN (
+    SELECT id FROM chirps AS original
+    WHERE original.user_id = sqlc.arg('user_id')::UUID
+);
+
+-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at <= sqlc.arg('deleted_before')::TIMESTAMP
+AND NOT EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.parent_id = chirps.id)
+AND NOT EXISTS (SELECT 1 FROM chirps AS quotes WHERE quotes.rechirp_of = chirps.id AND quotes.is_quote);
+
+-- name: ScrubDeletedChirps :execrows
+UPDATE chirps
+SET body = ''
+WHERE deleted_at <= sqlc.arg('deleted_before')::TIMESTAMP AND body <> '';
+
+-- name: PurgeDeletedChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id IN (
+    SELECT id FROM chirps
+    WHERE deleted_at <= sqlc.arg('deleted_before')::TIMESTAMP
+);
+
+-- name: PurgeUserChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id IN (
+    SELECT id FROM chirps
+    WHERE user_id = sqlc.arg('user_id')::UUID
+);
+
+-- name: TombstoneUserChirps :execrows
+UPDATE chirps
+SET body = '', user_id = NULL, deleted_at = COALESCE(deleted_at, NOW())
+WHERE user_id = sqlc.arg('user_id')::UUID
+AND (EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.parent_id = chirps.id)
+    OR EXISTS (SELECT 1 FROM chirps AS quotes WHERE quotes.rechirp_of = chirps.id AND quotes.is_quote));
 
 -- name: GetAuthorChirps :many
 SELECT * FROM chirps
-WHERE chirps.user_id = $1
-ORDER BY created_at;   
\ No newline at end of file
+WHERE chirps.user_id = sqlc.arg('user_id')::UUID AND chirps.deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: GetAuthorChirpsWithTrash :many
+SELECT * FROM chirps
+WHERE chirps.user_id = sqlc.arg('user_id')::UUID
+AND (chirps.deleted_at IS NULL OR chirps.deleted_at > sqlc.arg('deleted_after')::TIMESTAMP)
+ORDER BY created_at;   
+-- name: SearchChirps :many
+SELECT sqlc.embed(chirps),
+    ts_rank(chirps.search_vector, query)::REAL AS rank,
+    ts_headline('english', chirps.body, query, sqlc.arg('headline_options')::TEXT)::TEXT AS snippet
+FROM chirps, to_tsquery('english', sqlc.arg('query')::TEXT) AS query
+WHERE chirps.search_vector @@ query
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('author_id')::UUID IS NULL OR chirps.user_id = sqlc.narg('author_id')::UUID)
+AND (sqlc.narg('since')::TIMESTAMP IS NULL OR chirps.created_at >= sqlc.narg('since')::TIMESTAMP)
+AND (sqlc.narg('until')::TIMESTAMP IS NULL OR chirps.created_at < sqlc.narg('until')::TIMESTAMP)
+AND (sqlc.narg('after_rank')::REAL IS NULL
+    OR (ts_rank(chirps.search_vector, query), chirps.created_at, chirps.id)
+        < (sqlc.narg('after_rank')::REAL, sqlc.narg('after_created_at')::TIMESTAMP, sqlc.narg('after_id')::UUID))
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE chirps.id = $1 AND chirps.deleted_at IS NULL
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetReplyCounts :many
+SELECT parent_id, COUNT(*) AS reply_count FROM chirps
+WHERE parent_id = ANY(sqlc.arg(ids)::UUID[]) AND deleted_at IS NULL
+GROUP BY parent_id;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.*, 1 AS depth FROM chirps AS parent
+    WHERE parent.id = (SELECT start.parent_id FROM chirps AS start WHERE start.id = $1)
+    UNION ALL
+    SELECT parent.*, ancestors.depth + 1 FROM chirps AS parent
+    JOIN ancestors ON parent.id = ancestors.parent_id
+    WHERE ancestors.depth < 100
+)
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote FROM ancestors
+ORDER BY depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT reply.*, 1 AS depth,
+        ARRAY[to_char(reply.created_at, 'YYYYMMDDHH24MISSUS') || reply.id::TEXT] AS path
+    FROM chirps AS reply
+    WHERE reply.parent_id = sqlc.arg('root_id')::UUID
+    UNION ALL
+    SELECT reply.*, descendants.depth + 1,
+        descendants.path || (to_char(reply.created_at, 'YYYYMMDDHH24MISSUS') || reply.id::TEXT)
+    FROM chirps AS reply
+    JOIN descendants ON reply.parent_id = descendants.id
+    WHERE descendants.depth < sqlc.arg('max_depth')::INTEGER
+)
+SELECT id, created_at, updated_at, body, user_id, search_vector, deleted_at, parent_id, rechirp_of, like_count, is_quote,
+    depth::INTEGER AS depth, path::TEXT[] AS path
+FROM descendants
+WHERE (deleted_at IS NULL OR EXISTS (SELECT 1 FROM chirps AS child WHERE child.parent_id = descendants.id))
+AND (sqlc.narg('after_path')::TEXT[] IS NULL OR path > sqlc.narg('after_path')::TEXT[])
+ORDER BY path
+LIMIT sqlc.arg('limit');
+
+-- name: GetRechirpCounts :many
+SELECT rechirp_of,
+    COUNT(*) FILTER (WHERE NOT is_quote) AS rechirp_count,
+    COUNT(*) FILTER (WHERE is_quote) AS quote_count
+FROM chirps
+WHERE rechirp_of = ANY(sqlc.arg(ids)::UUID[]) AND deleted_at IS NULL
+GROUP BY rechirp_of;
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg(ids)::UUID[]);
+
+-- name: DeletePlainRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = sqlc.arg('user_id')::UUID AND rechirp_of = $1 AND NOT is_quote AND deleted_at IS NULL;
@@ -0,0 +1,45 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id, status, file_path, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    'pending',
+    NULL,
+    NULL
+)
+RETURNING *;
+
+-- name: HasPendingDataExport :one
+SELECT EXISTS (
+    SELECT 1 FROM data_exports
+    WHERE user_id = $1 AND status = 'pending' AND created_at > $2
+);
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', file_path = $2, expires_at = $3, updated_at = NOW()
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', expires_at = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: FailStaleDataExports :exec
+UPDATE data_exports
+SET status = 'failed', expires_at = NOW(), updated_at = NOW()
+WHERE status = 'pending' AND created_at <= $1;
+
+-- name: GetDataExport :one
+SELECT * FROM data_exports
+WHERE id = $1;
+
+-- name: GetExpiredDataExports :many
+SELECT * FROM data_exports
+WHERE expires_at IS NOT NULL AND expires_at <= NOW();
+
+-- name: DeleteDataExport :exec
+DELETE FROM data_exports
+WHERE id = $1;
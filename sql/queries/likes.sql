@@ -0,0 +1,38 @@
+-- name: CreateLike :execrows
+INSERT INTO likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: DeleteLike :execrows
+DELETE FROM likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: AddToLikeCount :one
+UPDATE chirps
+SET like_count = like_count + sqlc.arg('delta')::INTEGER
+WHERE id = $1
+RETURNING *;
+
+-- name: PurgeUserLikes :exec
+WITH removed AS (
+    DELETE FROM likes
+    WHERE likes.user_id = $1
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET like_count = like_count - 1
+WHERE id IN (SELECT chirp_id FROM removed);
+
+-- name: GetLikedChirpIDs :many
+SELECT chirp_id FROM likes
+WHERE user_id = $1 AND chirp_id = ANY(sqlc.arg(ids)::UUID[]);
+
+-- name: GetUserLikes :many
+SELECT sqlc.embed(chirps), likes.created_at AS liked_at FROM likes
+JOIN chirps ON chirps.id = likes.chirp_id
+WHERE likes.user_id = $1
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('before_liked_at')::TIMESTAMP IS NULL
+    OR (likes.created_at, likes.chirp_id) < (sqlc.narg('before_liked_at')::TIMESTAMP, sqlc.narg('before_chirp_id')::UUID))
+ORDER BY likes.created_at DESC, likes.chirp_id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,28 @@
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (attempt_key, failures, last_failure_at, locked_until)
+VALUES (
+    $1,
+    1,
+    $2,
+    NULL
+)
+ON CONFLICT (attempt_key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure_at < sqlc.arg(window_start)::TIMESTAMP THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = EXCLUDED.last_failure_at
+RETURNING failures;
+
+-- name: SetLoginLockout :exec
+UPDATE login_attempts
+SET locked_until = $2
+WHERE attempt_key = $1;
+
+-- name: GetLoginLockout :one
+SELECT locked_until FROM login_attempts
+WHERE attempt_key = $1;
+
+-- name: ClearLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE attempt_key = $1;
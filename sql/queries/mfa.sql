@@ -0,0 +1,61 @@
+-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET totp_secret = $2, totp_enabled = FALSE, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled = TRUE, totp_last_step = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: DisableUserTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (code_hash, created_at, user_id, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    NULL
+);
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL;
+
+-- name: CreateMFAChallenge :exec
+INSERT INTO mfa_challenges (token_hash, created_at, user_id, expires_at, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    NULL
+);
+
+-- name: GetMFAChallenge :one
+SELECT * FROM mfa_challenges
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND failed_attempts < 5;
+
+-- name: RecordMFAChallengeFailure :exec
+UPDATE mfa_challenges
+SET failed_attempts = failed_attempts + 1
+WHERE token_hash = $1;
+
+-- name: UseMFAChallenge :execrows
+UPDATE mfa_challenges
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL;
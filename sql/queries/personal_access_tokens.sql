@@ -0,0 +1,43 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, created_at, updated_at, user_id, name, token_hash, scopes, last_used_at, expires_at, revoked_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NULL,
+    $5,
+    NULL
+)
+RETURNING *;
+
+-- name: GetActivePersonalAccessToken :one
+SELECT * FROM personal_access_tokens
+WHERE token_hash = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at DESC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserPersonalAccessTokens :exec
+UPDATE personal_access_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
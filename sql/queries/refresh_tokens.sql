@@ -1,19 +1,66 @@
 -- name: CreateRefreshToken :exec
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, last_used_at, user_agent, ip_address)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
     $3,
-    NULL
+    NULL,
+    $4,
+    NOW(),
+    $5,
+    $6
 );
 
 -- name: GetRefreshToken :one
 SELECT * from refresh_tokens
-WHERE refresh_tokens.token = $1;
+WHERE refresh_tokens.token_hash = $1;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
\ No newline at end of file
+WHERE token_hash = $1;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW(), replaced_by = $2
+WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: GetUserSessions :many
+SELECT refresh_tokens.family_id,
+    (SELECT MIN(family.created_at) FROM refresh_tokens AS family WHERE family.family_id = refresh_tokens.family_id)::TIMESTAMP AS started_at,
+    refresh_tokens.last_used_at,
+    refresh_tokens.expires_at,
+    refresh_tokens.user_agent,
+    refresh_tokens.ip_address
+FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1 AND refresh_tokens.revoked_at IS NULL AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC;
+
+-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+);
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherUserSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
\ No newline at end of file
@@ -1,11 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
@@ -16,13 +17,104 @@ DELETE FROM users;
 SELECT * from users
 WHERE users.email = $1;
 
--- name: UpdateUser :one
+-- name: UpgradeUser :exec
+UPDATE users
+SET is_chirpy_red = TRUE
+WHERE id = $1;
+
+-- name: GetUserByID :one
+SELECT * from users
+WHERE users.id = $1;
+
+-- name: VerifyUserEmail :one
 UPDATE users
-SET email = $2, hashed_password = $3
+SET email_verified = TRUE, updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
--- name: UpgradeUser :exec
+-- name: UpdateUserPassword :exec
 UPDATE users
-SET is_chirpy_red = TRUE
-WHERE id = $1;
\ No newline at end of file
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: PatchUser :one
+UPDATE users
+SET email = COALESCE(sqlc.narg('email'), email),
+    hashed_password = COALESCE(sqlc.narg('hashed_password'), hashed_password),
+    handle = COALESCE(sqlc.narg('handle'), handle),
+    display_name = COALESCE(sqlc.narg('display_name'), display_name),
+    bio = COALESCE(sqlc.narg('bio'), bio),
+    avatar_url = COALESCE(sqlc.narg('avatar_url'), avatar_url),
+    email_verified = CASE
+        WHEN sqlc.narg('email')::TEXT IS NOT NULL AND sqlc.narg('email')::TEXT <> email THEN FALSE
+        ELSE email_verified
+    END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL;
+
+-- name: GetUsersDueForPurge :many
+SELECT id FROM users
+WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= NOW();
+
+-- name: PurgeDeletedUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= NOW();
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE LOWER(handle) = LOWER($1);
+
+-- name: GetUserHandles :many
+SELECT id, handle FROM users
+WHERE id = ANY(sqlc.arg(ids)::UUID[]) AND handle IS NOT NULL;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: BootstrapAdmin :execrows
+UPDATE users
+SET role = 'admin', updated_at = NOW()
+WHERE LOWER(email) = LOWER(sqlc.arg('email'))
+AND email_verified = TRUE
+AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin');
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE sqlc.arg('query')::TEXT = ''
+OR email ILIKE '%' || sqlc.arg('query')::TEXT || '%'
+OR handle ILIKE '%' || sqlc.arg('query')::TEXT || '%'
+ORDER BY created_at DESC
+LIMIT $1 OFFSET $2;
+
+-- name: SuspendUser :one
+UPDATE users
+SET suspended_until = $2, moderation_reason = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: BanUser :one
+UPDATE users
+SET banned_at = NOW(), moderation_reason = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UnbanUser :one
+UPDATE users
+SET suspended_until = NULL, banned_at = NULL, moderation_reason = '', updated_at = NOW()
+WHERE id = $1
+RETURNING *;
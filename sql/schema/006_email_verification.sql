@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Accounts created before verification existed are trusted as-is.
+UPDATE users SET email_verified = TRUE;
+
+CREATE TABLE verification_tokens(
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE verification_tokens;
+
+ALTER TABLE users
+DROP COLUMN email_verified;
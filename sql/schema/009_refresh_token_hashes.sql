@@ -0,0 +1,17 @@
+-- +goose Up
+-- Replace stored tokens with their SHA-256 digests. Existing sessions keep
+-- working because clients still hold the plaintext and the server hashes
+-- whatever it is given before looking it up.
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex'),
+    replaced_by = encode(sha256(convert_to(replaced_by, 'UTF8')), 'hex');
+
+-- +goose Down
+-- Digests can't be turned back into tokens, so every session is dropped.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
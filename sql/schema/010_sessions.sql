@@ -0,0 +1,17 @@
+-- +goose Up
+-- A token family is one login session; these columns describe the device
+-- that is holding it.
+ALTER TABLE refresh_tokens
+ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN ip_address,
+DROP COLUMN user_agent,
+DROP COLUMN last_used_at;
@@ -0,0 +1,37 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN totp_secret TEXT,
+ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE mfa_recovery_codes(
+    code_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE mfa_challenges(
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE mfa_challenges;
+
+DROP TABLE mfa_recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN totp_last_step,
+DROP COLUMN totp_enabled,
+DROP COLUMN totp_secret;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE login_attempts(
+    attempt_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP,
+ADD COLUMN banned_at TIMESTAMP,
+ADD COLUMN moderation_reason TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN suspended_until,
+DROP COLUMN banned_at,
+DROP COLUMN moderation_reason;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE chirp_revisions(
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    written_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_chirp_id
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_revisions_chirp_id_idx ON chirp_revisions (chirp_id, replaced_at);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN parent_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_parent_id_idx ON chirps (parent_id, created_at, id)
+WHERE parent_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_parent_id_idx;
+
+ALTER TABLE chirps
+DROP COLUMN parent_id;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN rechirp_of UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_rechirp_of_idx ON chirps (rechirp_of)
+WHERE rechirp_of IS NOT NULL;
+
+-- A plain rechirp has no body of its own and can only be made once
+CREATE UNIQUE INDEX chirps_plain_rechirp_idx ON chirps (user_id, rechirp_of)
+WHERE rechirp_of IS NOT NULL AND body = '' AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX chirps_plain_rechirp_idx;
+DROP INDEX chirps_rechirp_of_idx;
+
+ALTER TABLE chirps
+DROP COLUMN rechirp_of;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE likes(
+    user_id UUID NOT NULL,
+    chirp_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id),
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp_id
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX likes_user_id_created_at_idx ON likes (user_id, created_at, chirp_id);
+
+ALTER TABLE chirps
+ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN like_count;
+
+DROP TABLE likes;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- chirp_id has no foreign key so bookmarks outlive the chirps they point at
+CREATE TABLE bookmarks(
+    user_id UUID NOT NULL,
+    chirp_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id),
+    CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX bookmarks_user_id_created_at_idx ON bookmarks (user_id, created_at, chirp_id);
+
+-- +goose Down
+DROP TABLE bookmarks;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Chirps with replies outlive a deleted account as tombstones with no author
+ALTER TABLE chirps
+ALTER COLUMN user_id DROP NOT NULL;
+
+-- +goose Down
+DELETE FROM chirps WHERE user_id IS NULL;
+
+ALTER TABLE chirps
+ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- Whether a rechirp is a quote can't be told from its body, which is blanked
+-- when a deleted chirp is kept as a tombstone
+ALTER TABLE chirps
+ADD COLUMN is_quote BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Replies to plain rechirps go to the original, so a blank rechirp with
+-- replies was a quote
+UPDATE chirps
+SET is_quote = TRUE
+WHERE rechirp_of IS NOT NULL
+AND (body <> '' OR EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.parent_id = chirps.id));
+
+DROP INDEX chirps_plain_rechirp_idx;
+
+CREATE UNIQUE INDEX chirps_plain_rechirp_idx ON chirps (user_id, rechirp_of)
+WHERE rechirp_of IS NOT NULL AND NOT is_quote AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX chirps_plain_rechirp_idx;
+
+CREATE UNIQUE INDEX chirps_plain_rechirp_idx ON chirps (user_id, rechirp_of)
+WHERE rechirp_of IS NOT NULL AND body = '' AND deleted_at IS NULL;
+
+ALTER TABLE chirps
+DROP COLUMN is_quote;